@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"shared/audit"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAuditLogs godoc
+// @Summary Query the audit log
+// @Description Get the audit log of write operations, newest first. Requires an authorized role
+// @Tags audit
+// @Security ApiKeyAuth
+// @Produce json
+// @Param entity query string false "Entity name" Enums(order)
+// @Param entity_id query string false "Entity ID"
+// @Param actor query string false "Actor"
+// @Param limit query int false "Maximum number of entries" default(100)
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {array} audit.Log
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /audit [get]
+func GetAuditLogs(db *gorm.DB) gin.HandlerFunc {
+	return audit.Handler(db)
+}
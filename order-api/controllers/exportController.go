@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http"
+	"order-api/middleware"
+	"order-api/services"
+	"shared/apierror"
+	"shared/export"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportOrders godoc
+// @Summary Export orders
+// @Description Stream the orders matching the filters, in ID order, as CSV, NDJSON or XLSX. Rows are read from a database cursor and written as they arrive, so any number of orders can be exported
+// @Tags orders
+// @Security ApiKeyAuth
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "File format" Enums(csv, ndjson, xlsx) default(csv)
+// @Param columns query string false "Comma-separated columns, all by default" example(id,user_id,total_value,created_at)
+// @Param q query string false "Text in the item description"
+// @Param user_id query int false "User ID"
+// @Param status query string false "Order status" Enums(created, cancelled)
+// @Param min_total query number false "Minimum total value"
+// @Param max_total query number false "Maximum total value"
+// @Param from query string false "Created at or after (date or RFC 3339)"
+// @Param to query string false "Created before (RFC 3339), or on or before (date)"
+// @Success 200 {file} file
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /orders/export [get]
+func ExportOrders(db *gorm.DB) gin.HandlerFunc {
+	service := services.OrderService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanExportOrders(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		format, columns, err := export.ParseParams(c, services.OrderExportColumns)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		query, err := parseOrderFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		err = export.Stream(c, "orders", format, func(w export.Writer) error {
+			return service.ExportOrders(c.Request.Context(), query, columns, w)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to export orders"})
+		}
+	}
+}
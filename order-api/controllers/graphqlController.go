@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"order-api/graph"
+	"order-api/middleware"
+	"shared/cache"
+	"shared/config"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GraphQL godoc
+// @Summary GraphQL gateway
+// @Description Query orders and users, including order.user and user.orders, in a single request. Users are fetched from the user-api and lists are resolved in batches. Queries whose complexity exceeds GRAPHQL_MAX_COMPLEXITY are rejected; list fields count once per item they can return. Fields that fail come back as null with an entry in errors, while the rest of the data is returned. CPF, email and phone number of users are masked unless the API key has a role in PII_AUTHORIZED_ROLES
+// @Tags graphql
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param GraphQLRequest body models.GraphQLRequest true "GraphQL query"
+// @Success 200 {object} models.GraphQLResponse
+// @Failure 422 {object} models.GraphQLResponse
+// @Router /graphql [post]
+func GraphQL(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
+	handler := graph.NewHandler(&graph.Resolver{DB: db, Cache: orderCache}, config.GetEnvInt("GRAPHQL_MAX_COMPLEXITY", 1000))
+	return func(c *gin.Context) {
+		ctx := graph.WithFullPII(c.Request.Context(), middleware.CanViewUserPII(c))
+		handler.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+// GraphQLSchema godoc
+// @Summary GraphQL schema
+// @Description Export the GraphQL schema in SDL, for code generation and client tooling
+// @Tags graphql
+// @Security ApiKeyAuth
+// @Produce plain
+// @Success 200 {string} string
+// @Router /graphql/schema [get]
+func GraphQLSchema() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(graph.Schema))
+	}
+}
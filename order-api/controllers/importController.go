@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"order-api/middleware"
+	"order-api/models"
+	"order-api/services"
+	"shared/apierror"
+	"shared/audit"
+	"shared/config"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// importFormat resolves the format of an import from the format query parameter or the Content-Type
+func importFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return models.ImportFormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		return models.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// ImportOrders godoc
+// @Summary Import orders in bulk
+// @Description Import orders from CSV (header: user_id,item_description,item_quantity,item_price,total_value) or NDJSON (one OrderRequest per line). Each row is validated like POST /orders and the result of every row is reported. Imports larger than the synchronous limit, or with async=true, run in the background and return a job to poll
+// @Tags orders
+// @Security ApiKeyAuth
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "File format, defaults to the Content-Type" Enums(csv, ndjson)
+// @Param async query bool false "Run in the background regardless of size"
+// @Success 200 {object} models.ImportReport
+// @Success 202 {object} models.ImportJob
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 413 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /orders/import [post]
+func ImportOrders(db *gorm.DB, userProjection *services.UserProjectionService) gin.HandlerFunc {
+	maxBytes := int64(config.GetEnvInt("IMPORT_MAX_BYTES", 32<<20))
+	syncMaxRows := config.GetEnvInt("IMPORT_SYNC_MAX_ROWS", 1000)
+	chunkSize := config.GetEnvInt("IMPORT_CHUNK_SIZE", 500)
+	return func(c *gin.Context) {
+		if !middleware.CanImportOrders(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+		service := services.ImportService{DB: db, Audit: audit.RequestMetadata(c), ChunkSize: chunkSize, UserProjection: userProjection}
+
+		format := importFormat(c)
+		if format != models.ImportFormatCSV && format != models.ImportFormatNDJSON {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Unsupported format, use text/csv or application/x-ndjson"})
+			return
+		}
+
+		file, err := services.SpoolImport(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes), format)
+		if err != nil {
+			c.Error(err)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, apierror.ErrorResponse{Error: "Import file too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if file.Rows == 0 {
+			file.Close()
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "No rows to import"})
+			return
+		}
+
+		if file.Rows > syncMaxRows || c.Query("async") == "true" {
+			job, err := service.StartImportJob(c.Request.Context(), file)
+			if err != nil {
+				file.Close()
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Header("Location", "/orders/import/"+job.ID)
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+
+		defer file.Close()
+		rows, err := file.Reader()
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to read import file"})
+			return
+		}
+		report, err := service.Import(c.Request.Context(), rows)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to read import file"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetImportJob godoc
+// @Summary Get an import job
+// @Description Get the status of a background import; the per-row results are included once it completes
+// @Tags orders
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.ImportJob
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Router /orders/import/{id} [get]
+func GetImportJob(db *gorm.DB) gin.HandlerFunc {
+	service := services.ImportService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanImportOrders(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		job, err := service.GetImportJob(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Import job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
@@ -1,29 +1,62 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"order-api/middleware"
 	"order-api/models"
 	"order-api/services"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// parseExpand reports whether ?expand=user asks for the users to be embedded in the orders
+func parseExpand(c *gin.Context) (bool, error) {
+	value := c.Query("expand")
+	if value == "" {
+		return false, nil
+	}
+	for _, field := range strings.Split(value, ",") {
+		if strings.TrimSpace(field) != "user" {
+			return false, errors.New("Invalid expand")
+		}
+	}
+	return true, nil
+}
+
 // GetOrders godoc
 // @Summary Get all orders
-// @Description Get all orders
+// @Description Get all orders. With expand=user each order embeds its user, as in models.ExpandedOrder, fetched from the user-api in one batch; if the user-api is unavailable the orders come without users and with partial set
 // @Tags orders
+// @Security ApiKeyAuth
 // @Produce json
+// @Param expand query string false "Related data to embed" Enums(user)
 // @Success 200 {array} models.Order
-// @Failure 500 {object} models.ErrorResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
 // @Router /orders [get]
 func GetOrders(db *gorm.DB) gin.HandlerFunc {
 	service := services.OrderService{DB: db}
 	return func(c *gin.Context) {
-		orders, err := service.GetAllOrders()
+		expand, err := parseExpand(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch orders"})
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		orders, err := service.GetAllOrders(c.Request.Context())
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch orders"})
+			return
+		}
+		if expand {
+			c.JSON(http.StatusOK, service.ExpandUsers(c.Request.Context(), orders, middleware.CanViewUserPII(c)))
 			return
 		}
 		c.JSON(http.StatusOK, orders)
@@ -32,19 +65,32 @@ func GetOrders(db *gorm.DB) gin.HandlerFunc {
 
 // GetOrderByID godoc
 // @Summary Get order by ID
-// @Description Get a specific order by ID
+// @Description Get a specific order by ID. With expand=user the order embeds its user, as in models.ExpandedOrder; if the user-api is unavailable the order comes without the user and with partial set
 // @Tags orders
+// @Security ApiKeyAuth
 // @Produce json
 // @Param id path int true "Order ID"
+// @Param expand query string false "Related data to embed" Enums(user)
 // @Success 200 {object} models.Order
-// @Failure 404 {object} models.ErrorResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
 // @Router /orders/{id} [get]
-func GetOrderByID(db *gorm.DB) gin.HandlerFunc {
-	service := services.OrderService{DB: db}
+func GetOrderByID(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
+	service := services.OrderService{DB: db, Cache: orderCache}
 	return func(c *gin.Context) {
-		order, err := service.GetOrderByID(c.Param("id"))
+		expand, err := parseExpand(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		order, err := service.GetOrderByID(c.Request.Context(), c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Order not found"})
+			c.Error(err)
+			c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Order not found"})
+			return
+		}
+		if expand {
+			c.JSON(http.StatusOK, service.ExpandUsers(c.Request.Context(), []models.Order{*order}, middleware.CanViewUserPII(c))[0])
 			return
 		}
 		c.JSON(http.StatusOK, order)
@@ -53,25 +99,38 @@ func GetOrderByID(db *gorm.DB) gin.HandlerFunc {
 
 // GetOrdersByUserID godoc
 // @Summary Get orders by user ID
-// @Description Get orders for a specific user by user ID
+// @Description Get orders for a specific user by user ID. With expand=user each order embeds the user, as in models.ExpandedOrder; if the user-api is unavailable the orders come without the user and with partial set
 // @Tags orders
+// @Security ApiKeyAuth
 // @Produce json
 // @Param id path int true "User ID"
+// @Param expand query string false "Related data to embed" Enums(user)
 // @Success 200 {array} models.Order
-// @Failure 400 {object} models.ErrorResponse
-// @Failure 500 {object} models.ErrorResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
 // @Router /users/{id}/orders [get]
 func GetOrdersByUserID(db *gorm.DB) gin.HandlerFunc {
 	service := services.OrderService{DB: db}
 	return func(c *gin.Context) {
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid user ID"})
 			return
 		}
-		orders, err := service.GetOrdersByUserID(userID)
+		expand, err := parseExpand(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch orders"})
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		orders, err := service.GetOrdersByUserID(c.Request.Context(), userID)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch orders"})
+			return
+		}
+		if expand {
+			c.JSON(http.StatusOK, service.ExpandUsers(c.Request.Context(), orders, middleware.CanViewUserPII(c)))
 			return
 		}
 		c.JSON(http.StatusOK, orders)
@@ -82,18 +141,25 @@ func GetOrdersByUserID(db *gorm.DB) gin.HandlerFunc {
 // @Summary Create a new OrderRequest
 // @Description Create a new OrderRequest
 // @Tags orders
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param OrderRequest body models.OrderRequest true "OrderRequest"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
 // @Success 201 {object} models.Order
-// @Failure 400 {object} models.ErrorResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 409 {object} apierror.ErrorResponse
+// @Failure 422 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Failure 503 {object} apierror.ErrorResponse
 // @Router /orders [post]
-func CreateOrder(db *gorm.DB) gin.HandlerFunc {
-	service := services.OrderService{DB: db}
+func CreateOrder(db *gorm.DB, userProjection *services.UserProjectionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		service := services.OrderService{DB: db, Audit: audit.RequestMetadata(c), UserProjection: userProjection}
 		var orderRequest models.OrderRequest
 		if err := c.ShouldBindJSON(&orderRequest); err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
 			return
 		}
 
@@ -105,8 +171,16 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 			TotalValue:      orderRequest.TotalValue,
 		}
 
-		if err := service.CreateOrder(&order); err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		if err := service.CreateOrder(c.Request.Context(), &order); err != nil {
+			c.Error(err)
+			switch {
+			case errors.Is(err, services.ErrInvalidOrder):
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			case errors.Is(err, services.ErrUserVerification):
+				c.JSON(http.StatusServiceUnavailable, apierror.ErrorResponse{Error: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			}
 			return
 		}
 
@@ -118,19 +192,23 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 // @Summary Update an order
 // @Description Update an existing order by ID
 // @Tags orders
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Order ID"
 // @Param OrderRequest body models.OrderRequest true "OrderRequest"
 // @Success 200 {object} models.Order
-// @Failure 400 {object} models.ErrorResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
 // @Router /orders/{id} [put]
-func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
-	service := services.OrderService{DB: db}
+func UpdateOrder(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		service := services.OrderService{DB: db, Audit: audit.RequestMetadata(c), Cache: orderCache}
 		var orderRequest models.OrderRequest
 		if err := c.ShouldBindJSON(&orderRequest); err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
 			return
 		}
 
@@ -142,9 +220,17 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 			TotalValue:      orderRequest.TotalValue,
 		}
 
-		updatedOrder, err := service.UpdateOrder(c.Param("id"), &order)
+		updatedOrder, err := service.UpdateOrder(c.Request.Context(), c.Param("id"), &order)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			c.Error(err)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Order not found"})
+			case errors.Is(err, services.ErrInvalidOrder):
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			}
 			return
 		}
 
@@ -156,17 +242,91 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 // @Summary Delete an order
 // @Description Delete an order by ID
 // @Tags orders
+// @Security ApiKeyAuth
 // @Param id path int true "Order ID"
-// @Success 200 {object} models.ErrorResponse
-// @Failure 404 {object} models.ErrorResponse
+// @Success 200 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
 // @Router /orders/{id} [delete]
-func DeleteOrder(db *gorm.DB) gin.HandlerFunc {
-	service := services.OrderService{DB: db}
+func DeleteOrder(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := service.DeleteOrder(c.Param("id")); err != nil {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Order not found"})
+		service := services.OrderService{DB: db, Audit: audit.RequestMetadata(c), Cache: orderCache}
+		if err := service.DeleteOrder(c.Request.Context(), c.Param("id")); err != nil {
+			c.Error(err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Order not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			}
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "Order deleted"})
 	}
 }
+
+// PseudonymizeUserOrders godoc
+// @Summary Pseudonymize a user's orders
+// @Description Replace the user ID of all of a user's orders with a pseudonym, keeping financial totals. Called by the user-api when erasing a user's personal data. Requires an authorized role
+// @Tags orders
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.PseudonymizeResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /users/{id}/orders/pseudonymize [post]
+func PseudonymizeUserOrders(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !middleware.CanPseudonymizeOrders(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+		service := services.OrderService{DB: db, Audit: audit.RequestMetadata(c), Cache: orderCache}
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+		count, err := service.PseudonymizeOrdersByUserID(c.Request.Context(), userID)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to pseudonymize orders"})
+			return
+		}
+		c.JSON(http.StatusOK, models.PseudonymizeResponse{OrdersPseudonymized: count})
+	}
+}
+
+// CancelOrder godoc
+// @Summary Cancel an order
+// @Description Cancel an order by ID. Cancelled orders can no longer be updated
+// @Tags orders
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /orders/{id}/cancel [post]
+func CancelOrder(db *gorm.DB, orderCache cache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.OrderService{DB: db, Audit: audit.RequestMetadata(c), Cache: orderCache}
+		order, err := service.CancelOrder(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Order not found"})
+			case errors.Is(err, services.ErrInvalidOrder):
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
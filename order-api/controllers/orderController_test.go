@@ -7,22 +7,26 @@ import (
 	"net/http/httptest"
 	"order-api/models"
 	"order-api/utils/mocks"
+	"shared/audit"
+	"shared/database/databasetest"
+	"shared/outbox"
 	"strconv"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetOrdersSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
-	mockService.On("GetAllOrders").Return([]models.Order{}, nil)
+	mockService.On("GetAllOrders", mock.Anything).Return([]models.Order{}, nil)
 
 	router := gin.Default()
 	router.GET("/orders", func(c *gin.Context) {
 		service := mockService
-		orders, err := service.GetAllOrders()
+		orders, err := service.GetAllOrders(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 			return
@@ -40,12 +44,12 @@ func TestGetOrdersSuccess(t *testing.T) {
 
 func TestGetOrderByIDSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
-	mockService.On("GetOrderByID", "1").Return(&models.Order{}, nil)
+	mockService.On("GetOrderByID", mock.Anything, "1").Return(&models.Order{}, nil)
 
 	router := gin.Default()
 	router.GET("/orders/:id", func(c *gin.Context) {
 		service := mockService
-		order, err := service.GetOrderByID(c.Param("id"))
+		order, err := service.GetOrderByID(c.Request.Context(), c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
@@ -63,7 +67,7 @@ func TestGetOrderByIDSuccess(t *testing.T) {
 
 func TestGetOrdersByUserIDSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
-	mockService.On("GetOrdersByUserID", 1).Return([]models.Order{}, nil)
+	mockService.On("GetOrdersByUserID", mock.Anything, 1).Return([]models.Order{}, nil)
 
 	router := gin.Default()
 	router.GET("/users/:id/orders", func(c *gin.Context) {
@@ -73,7 +77,7 @@ func TestGetOrdersByUserIDSuccess(t *testing.T) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 			return
 		}
-		orders, err := service.GetOrdersByUserID(userID)
+		orders, err := service.GetOrdersByUserID(c.Request.Context(), userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 			return
@@ -92,7 +96,7 @@ func TestGetOrdersByUserIDSuccess(t *testing.T) {
 func TestCreateOrderSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
 	order := models.Order{UserID: 1, ItemDescription: "Item", ItemQuantity: 1, ItemPrice: 10.0, TotalValue: 10.0}
-	mockService.On("CreateOrder", mock.AnythingOfType("*models.Order")).Return(nil)
+	mockService.On("CreateOrder", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
 
 	router := gin.Default()
 	router.POST("/orders", func(c *gin.Context) {
@@ -103,7 +107,7 @@ func TestCreateOrderSuccess(t *testing.T) {
 			return
 		}
 
-		if err := service.CreateOrder(&order); err != nil {
+		if err := service.CreateOrder(c.Request.Context(), &order); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -123,7 +127,7 @@ func TestCreateOrderSuccess(t *testing.T) {
 func TestUpdateOrderSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
 	order := models.Order{UserID: 1, ItemDescription: "Updated Item", ItemQuantity: 2, ItemPrice: 20.0, TotalValue: 40.0}
-	mockService.On("UpdateOrder", "1", &order).Return(&order, nil)
+	mockService.On("UpdateOrder", mock.Anything, "1", &order).Return(&order, nil)
 
 	router := gin.Default()
 	router.PUT("/orders/:id", func(c *gin.Context) {
@@ -134,7 +138,7 @@ func TestUpdateOrderSuccess(t *testing.T) {
 			return
 		}
 
-		updatedOrder, err := service.UpdateOrder(c.Param("id"), &order)
+		updatedOrder, err := service.UpdateOrder(c.Request.Context(), c.Param("id"), &order)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -154,12 +158,12 @@ func TestUpdateOrderSuccess(t *testing.T) {
 
 func TestDeleteOrderSuccess(t *testing.T) {
 	mockService := new(mocks.OrderServiceMock)
-	mockService.On("DeleteOrder", "1").Return(nil)
+	mockService.On("DeleteOrder", mock.Anything, "1").Return(nil)
 
 	router := gin.Default()
 	router.DELETE("/orders/:id", func(c *gin.Context) {
 		service := mockService
-		if err := service.DeleteOrder(c.Param("id")); err != nil {
+		if err := service.DeleteOrder(c.Request.Context(), c.Param("id")); err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
 		}
@@ -173,3 +177,59 @@ func TestDeleteOrderSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockService.AssertExpectations(t)
 }
+
+func TestPseudonymizeUserOrdersSuccess(t *testing.T) {
+	mockService := new(mocks.OrderServiceMock)
+	mockService.On("PseudonymizeOrdersByUserID", mock.Anything, 1).Return(int64(2), nil)
+
+	router := gin.Default()
+	router.POST("/users/:id/orders/pseudonymize", func(c *gin.Context) {
+		service := mockService
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		count, err := service.PseudonymizeOrdersByUserID(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pseudonymize orders"})
+			return
+		}
+		c.JSON(http.StatusOK, models.PseudonymizeResponse{OrdersPseudonymized: count})
+	})
+
+	req, _ := http.NewRequest("POST", "/users/1/orders/pseudonymize", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"orders_pseudonymized": 2}`, w.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestUpdateAndDeleteOrderMapErrors(t *testing.T) {
+	db := databasetest.Open(t, &models.Order{}, &outbox.Event{}, &audit.Log{})
+	cancelled := models.Order{UserID: 1, ItemDescription: "Item", ItemQuantity: 1, ItemPrice: 10, TotalValue: 10, Status: models.OrderStatusCancelled}
+	require.NoError(t, db.Create(&cancelled).Error)
+
+	router := gin.New()
+	router.PUT("/orders/:id", UpdateOrder(db, nil))
+	router.DELETE("/orders/:id", DeleteOrder(db, nil))
+	request := func(method, path string) int {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(`{"item_quantity":2}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, request("PUT", "/orders/99"))
+	assert.Equal(t, http.StatusBadRequest, request("PUT", "/orders/"+strconv.Itoa(int(cancelled.ID))))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/orders/99"))
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.Close()
+	assert.Equal(t, http.StatusInternalServerError, request("PUT", "/orders/1"))
+	assert.Equal(t, http.StatusInternalServerError, request("DELETE", "/orders/1"))
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"order-api/models"
+	"order-api/services"
+	"shared/apierror"
+	"shared/export"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetOrderReport godoc
+// @Summary Order report
+// @Description Get revenue, order count and average ticket grouped by day, week, month or user, with the totals of the range. Cancelled orders are not counted. Reports grouped by user list the users with the highest revenue first
+// @Tags reports
+// @Security ApiKeyAuth
+// @Produce json
+// @Produce text/csv
+// @Param group_by query string false "Grouping" Enums(day, week, month, user) default(day)
+// @Param from query string false "Created at or after (date or RFC 3339)"
+// @Param to query string false "Created before (RFC 3339), or on or before (date)"
+// @Param limit query int false "Maximum number of users when grouped by user (up to 1000)" default(100)
+// @Param format query string false "Response format" Enums(json, csv) default(json)
+// @Success 200 {object} models.OrderReport
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /reports/orders [get]
+func GetOrderReport(db *gorm.DB) gin.HandlerFunc {
+	service := services.ReportService{DB: db}
+	return func(c *gin.Context) {
+		filter := models.OrderReportFilter{GroupBy: c.DefaultQuery("group_by", models.ReportGroupByDay)}
+		switch filter.GroupBy {
+		case models.ReportGroupByDay, models.ReportGroupByWeek, models.ReportGroupByMonth, models.ReportGroupByUser:
+		default:
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid group_by"})
+			return
+		}
+
+		var err error
+		if filter.From, err = export.ParseDateParam(c, "from", false); err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if filter.To, err = export.ParseDateParam(c, "to", true); err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "from must be before to"})
+			return
+		}
+		filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid limit"})
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid format"})
+			return
+		}
+
+		report, err := service.OrderReport(c.Request.Context(), filter)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to build report"})
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=orders-report-"+report.GroupBy+".csv")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := writeReportCSV(c.Writer, report); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// writeReportCSV writes one line per report row; the key columns depend on the grouping
+func writeReportCSV(w io.Writer, report *models.OrderReport) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"period"}
+	if report.GroupBy == models.ReportGroupByUser {
+		header = []string{"user_id", "user_pseudonym"}
+	}
+	if err := writer.Write(append(header, "order_count", "revenue", "average_ticket")); err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		var key []string
+		if report.GroupBy == models.ReportGroupByUser {
+			userID := ""
+			if row.UserID != nil {
+				userID = strconv.FormatUint(uint64(*row.UserID), 10)
+			}
+			key = []string{userID, row.UserPseudonym}
+		} else {
+			period := ""
+			if row.Period != nil {
+				period = row.Period.Format(time.DateOnly)
+			}
+			key = []string{period}
+		}
+		record := append(key,
+			strconv.FormatInt(row.OrderCount, 10),
+			strconv.FormatFloat(row.Revenue, 'f', 2, 64),
+			strconv.FormatFloat(row.AverageTicket, 'f', 2, 64),
+		)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"bytes"
+	"order-api/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReportCSVByPeriod(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	report := &models.OrderReport{
+		GroupBy: models.ReportGroupByDay,
+		Rows:    []models.OrderReportRow{{Period: &day, OrderCount: 3, Revenue: 100, AverageTicket: 33.333}},
+	}
+
+	var buf bytes.Buffer
+	err := writeReportCSV(&buf, report)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "period,order_count,revenue,average_ticket\n2024-03-01,3,100.00,33.33\n", buf.String())
+}
+
+func TestWriteReportCSVByUser(t *testing.T) {
+	userID := uint(7)
+	anonymous := uint(0)
+	report := &models.OrderReport{
+		GroupBy: models.ReportGroupByUser,
+		Rows: []models.OrderReportRow{
+			{UserID: &userID, OrderCount: 2, Revenue: 50, AverageTicket: 25},
+			{UserID: &anonymous, UserPseudonym: "anon-1a2b", OrderCount: 1, Revenue: 10, AverageTicket: 10},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := writeReportCSV(&buf, report)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user_id,user_pseudonym,order_count,revenue,average_ticket\n7,,2,50.00,25.00\n0,anon-1a2b,1,10.00,10.00\n", buf.String())
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-api/models"
+	"order-api/search"
+	"order-api/services"
+	"shared/apierror"
+	"shared/export"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxSearchLimit = 100
+
+// maxSearchWindow is the deepest result a search can reach (offset plus limit), the default
+// index.max_result_window of Elasticsearch
+const maxSearchWindow = 10000
+
+// parseOrderFilters reads the search text and filters from the query string
+func parseOrderFilters(c *gin.Context) (models.OrderSearchQuery, error) {
+	query := models.OrderSearchQuery{Text: c.Query("q"), Status: c.Query("status")}
+	var err error
+
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return query, errors.New("Invalid user_id")
+		}
+		query.UserID = uint(userID)
+	}
+	if value := c.Query("min_total"); value != "" {
+		if query.MinTotal, err = strconv.ParseFloat(value, 64); err != nil {
+			return query, errors.New("Invalid min_total")
+		}
+	}
+	if value := c.Query("max_total"); value != "" {
+		if query.MaxTotal, err = strconv.ParseFloat(value, 64); err != nil {
+			return query, errors.New("Invalid max_total")
+		}
+	}
+	if query.From, err = export.ParseDateParam(c, "from", false); err != nil {
+		return query, err
+	}
+	if query.To, err = export.ParseDateParam(c, "to", true); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseSearchQuery reads the search text, filters and pagination from the query string
+func parseSearchQuery(c *gin.Context) (models.OrderSearchQuery, error) {
+	query, err := parseOrderFilters(c)
+	if err != nil {
+		return query, err
+	}
+
+	query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || query.Limit < 1 || query.Limit > maxSearchLimit {
+		return query, errors.New("Invalid limit")
+	}
+	query.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || query.Offset < 0 {
+		return query, errors.New("Invalid offset")
+	}
+	if query.Offset+query.Limit > maxSearchWindow {
+		return query, fmt.Errorf("Offset plus limit must not exceed %d", maxSearchWindow)
+	}
+	return query, nil
+}
+
+// SearchOrders godoc
+// @Summary Search orders
+// @Description Search orders by item description, tolerating small typos, with optional filters. Matching parts of the description are returned in highlights wrapped in <em> tags
+// @Tags orders
+// @Security ApiKeyAuth
+// @Produce json
+// @Param q query string false "Text to search in the item description"
+// @Param user_id query int false "User ID"
+// @Param status query string false "Order status" Enums(created, cancelled)
+// @Param min_total query number false "Minimum total value"
+// @Param max_total query number false "Maximum total value"
+// @Param from query string false "Created at or after (date or RFC 3339)"
+// @Param to query string false "Created before (RFC 3339), or on or before (date)"
+// @Param limit query int false "Maximum number of results (up to 100)" default(20)
+// @Param offset query int false "Number of results to skip; offset plus limit must not exceed 10000"
+// @Success 200 {object} models.OrderSearchResult
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /orders/search [get]
+func SearchOrders(db *gorm.DB, index search.OrderIndex) gin.HandlerFunc {
+	service := services.SearchService{DB: db, Index: index}
+	return func(c *gin.Context) {
+		query, err := parseSearchQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		result, err := service.SearchOrders(c.Request.Context(), query)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to search orders"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
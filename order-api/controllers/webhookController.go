@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"order-api/middleware"
+	"order-api/models"
+	"order-api/services"
+	"shared/apierror"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webhookLimit parses the limit query parameter of the delivery listings
+func webhookLimit(c *gin.Context) (int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid limit"})
+		return 0, false
+	}
+	return limit, true
+}
+
+// CreateWebhook godoc
+// @Summary Register a webhook
+// @Description Subscribe a URL to order events. Deliveries are signed with HMAC-SHA256 of "<timestamp>.<body>" using the secret, sent in X-Webhook-Signature. A secret is generated when none is given and is only returned here. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param WebhookRequest body models.WebhookRequest true "WebhookRequest"
+// @Success 201 {object} models.WebhookSubscriptionCreated
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Router /webhooks [post]
+func CreateWebhook(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		var request models.WebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		subscription, err := service.CreateSubscription(c.Request.Context(), &request)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, subscription)
+	}
+}
+
+// GetWebhooks godoc
+// @Summary Get all webhooks
+// @Description Get all webhook subscriptions. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /webhooks [get]
+func GetWebhooks(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		subscriptions, err := service.GetSubscriptions(c.Request.Context())
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch webhooks"})
+			return
+		}
+		c.JSON(http.StatusOK, subscriptions)
+	}
+}
+
+// GetWebhookByID godoc
+// @Summary Get webhook by ID
+// @Description Get a specific webhook subscription by ID. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Router /webhooks/{id} [get]
+func GetWebhookByID(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		subscription, err := service.GetSubscriptionByID(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Webhook not found"})
+			return
+		}
+		c.JSON(http.StatusOK, subscription)
+	}
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Delete a webhook subscription by ID. Pending deliveries of the subscription are dead-lettered. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		if err := service.DeleteSubscription(c.Request.Context(), c.Param("id")); err != nil {
+			c.Error(err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Webhook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	}
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get webhook delivery history
+// @Description Get the deliveries of a webhook subscription, newest first. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "Maximum number of deliveries" default(100)
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func GetWebhookDeliveries(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+		limit, ok := webhookLimit(c)
+		if !ok {
+			return
+		}
+
+		deliveries, err := service.GetDeliveries(c.Request.Context(), c.Param("id"), limit)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch deliveries"})
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// GetWebhookDeadLetters godoc
+// @Summary Get dead-lettered webhook deliveries
+// @Description Get the deliveries that exhausted their retries, newest first. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Param limit query int false "Maximum number of deliveries" default(100)
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /webhooks/dead-letters [get]
+func GetWebhookDeadLetters(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+		limit, ok := webhookLimit(c)
+		if !ok {
+			return
+		}
+
+		deliveries, err := service.GetDeadLetters(c.Request.Context(), limit)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch deliveries"})
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// GetWebhookDeliveryAttempts godoc
+// @Summary Get the attempts of a webhook delivery
+// @Description Get every attempt to send a delivery with its status code, error and duration, oldest first. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {array} models.WebhookDeliveryAttempt
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /webhooks/deliveries/{id}/attempts [get]
+func GetWebhookDeliveryAttempts(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		attempts, err := service.GetDeliveryAttempts(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Delivery not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch delivery attempts"})
+			return
+		}
+		c.JSON(http.StatusOK, attempts)
+	}
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver a webhook delivery
+// @Description Schedule a delivery to be sent again right away with a fresh set of retries; attempt numbers keep growing. A delivery being sent is refused with 409. Requires an authorized role
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 409 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /webhooks/deliveries/{id}/redeliver [post]
+func RedeliverWebhook(db *gorm.DB) gin.HandlerFunc {
+	service := services.WebhookService{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanManageWebhooks(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		delivery, err := service.Redeliver(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Delivery not found"})
+			case errors.Is(err, services.ErrDeliveryInFlight):
+				c.JSON(http.StatusConflict, apierror.ErrorResponse{Error: "Delivery is being sent, try again later"})
+			default:
+				c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"order-api/models"
+	"order-api/utils"
+	"shared/database/databasetest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func execute(t *testing.T, h http.Handler, query string) graphQLResponse {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var response graphQLResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestUsersAreFetchedInOneBatch(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]uint
+	resolver := &Resolver{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		mu.Lock()
+		calls = append(calls, userIDs)
+		mu.Unlock()
+		return map[uint]models.User{1: {ID: 1, Name: "Maria"}, 3: {ID: 3, Name: "João"}}, nil
+	}, 10*time.Millisecond, 100)}
+
+	response := execute(t, NewHandler(resolver, 1000), `{ users(ids: [3, 2, 1, 3]) { id name } }`)
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"users": [{"id": "3", "name": "João"}, {"id": "1", "name": "Maria"}]}`, string(response.Data))
+	assert.Len(t, calls, 1)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, calls[0])
+}
+
+func TestUserAPIFailureIsReportedOnTheField(t *testing.T) {
+	resolver := &Resolver{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return nil, errors.New("dial tcp: connection refused")
+	}, time.Millisecond, 100)}
+
+	response := execute(t, NewHandler(resolver, 1000), `{ user(id: 1) { name } }`)
+
+	assert.JSONEq(t, `{"user": null}`, string(response.Data))
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "failed to fetch user", response.Errors[0].Message)
+}
+
+func TestComplexityLimit(t *testing.T) {
+	h := NewHandler(&Resolver{}, 1000)
+
+	response := execute(t, h, `{ orders(limit: 100) { id user { orders(limit: 100) { id } } } }`)
+
+	assert.Len(t, response.Errors, 1)
+	assert.Contains(t, response.Errors[0].Message, "operation has complexity 10301, which exceeds the limit of 1000")
+}
+
+func TestPseudonymizedOrderHasNoUser(t *testing.T) {
+	resolver := &Resolver{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		t.Fatal("the user-api must not be called")
+		return nil, nil
+	}, time.Millisecond, 100)}
+
+	user, err := resolver.Order().User(context.Background(), &models.Order{ID: 1, UserPseudonym: "anon-1a2b"})
+
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestNullLimitsUseTheDefaults(t *testing.T) {
+	db := databasetest.Open(t, &models.Order{})
+	require.NoError(t, db.Create(&models.Order{UserID: 1, ItemDescription: "Caneta", ItemQuantity: 1, ItemPrice: 1, TotalValue: 1}).Error)
+	resolver := &Resolver{DB: db, Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return map[uint]models.User{1: {ID: 1}}, nil
+	}, time.Millisecond, 100)}
+
+	response := execute(t, NewHandler(resolver, 1000), `{ orders(limit: null, offset: null) { id user { orders(limit: null) { id } } } }`)
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"orders": [{"id": "1", "user": {"orders": [{"id": "1"}]}}]}`, string(response.Data))
+}
+
+func TestUserPIIIsMaskedUnlessAllowed(t *testing.T) {
+	resolver := &Resolver{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return map[uint]models.User{1: {ID: 1, CPF: "12345678909", Email: "maria@example.com", PhoneNumber: "11912345678"}}, nil
+	}, time.Millisecond, 100)}
+	h := NewHandler(resolver, 1000)
+	query := `{ user(id: 1) { cpf email phoneNumber } users(ids: [1]) { cpf } }`
+
+	response := execute(t, h, query)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"user": {"cpf": "***.***.789-09", "email": "m***@example.com", "phoneNumber": "*******5678"}, "users": [{"cpf": "***.***.789-09"}]}`, string(response.Data))
+
+	full := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(WithFullPII(r.Context(), true)))
+	})
+	response = execute(t, full, query)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"user": {"cpf": "12345678909", "email": "maria@example.com", "phoneNumber": "11912345678"}, "users": [{"cpf": "12345678909"}]}`, string(response.Data))
+}
+
+func TestSchemaExport(t *testing.T) {
+	assert.Contains(t, Schema, "type Order {")
+	assert.Contains(t, Schema, "orders(limit: Int = 20): [Order!]!")
+}
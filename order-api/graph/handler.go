@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"shared/apierror"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Schema is the GraphQL schema in SDL, served by the schema export endpoint
+//
+//go:embed schema.graphqls
+var Schema string
+
+// maxListLimit is the largest page a list field returns
+const maxListLimit = 100
+
+// defaultListLimit is the page a list field returns when its limit is null, as the schema default
+const defaultListLimit = 20
+
+// checkLimit validates the limit argument of a list field
+func checkLimit(limit int) error {
+	if limit < 1 || limit > maxListLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	return nil
+}
+
+// complexity weighs list fields by the number of items they can return, so nesting lists multiplies
+// the cost of a query
+func complexity() ComplexityRoot {
+	var c ComplexityRoot
+	c.Query.Orders = func(childComplexity int, userID *uint, status *string, from *time.Time, to *time.Time, limit *int, offset *int) int {
+		return 1 + childComplexity*listSize(limit)
+	}
+	c.Query.Users = func(childComplexity int, ids []uint) int {
+		return 1 + childComplexity*len(ids)
+	}
+	c.User.Orders = func(childComplexity int, limit *int) int {
+		return 1 + childComplexity*listSize(limit)
+	}
+	return c
+}
+
+// listSize returns the number of items a list field can return for its limit argument
+func listSize(limit *int) int {
+	size := intArg(limit, defaultListLimit)
+	if size < 1 || size > maxListLimit {
+		return maxListLimit
+	}
+	return size
+}
+
+// NewHandler returns the HTTP handler of the GraphQL endpoint, which accepts queries by POST and
+// rejects those whose complexity exceeds maxComplexity
+func NewHandler(resolver *Resolver, maxComplexity int) http.Handler {
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: resolver, Complexity: complexity()}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(maxComplexity))
+	srv.AroundOperations(func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(resolver.withLoaders(ctx))
+	})
+	srv.SetErrorPresenter(presentError)
+	return srv
+}
+
+// presentError logs the cause of resolver errors; their messages are already safe to show
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) && gqlErr.Err != nil {
+		if cause := errors.Unwrap(gqlErr.Err); cause != nil {
+			slog.ErrorContext(ctx, "graphql resolver failed", "path", presented.Path.String(),
+				"error", presented.Message, "cause", apierror.RootCause(cause).Error())
+		}
+	}
+	return presented
+}
@@ -0,0 +1,103 @@
+package graph
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+import (
+	"context"
+	"order-api/models"
+	"order-api/services"
+	"order-api/utils"
+	"shared/cache"
+	"shared/config"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// batchWindow is how long the orders of users wait for other users' orders before being fetched together
+var batchWindow = config.GetEnvDuration("GRAPHQL_BATCH_WINDOW", 2*time.Millisecond)
+
+// Resolver resolves the gateway schema. Orders come from this service's database and users from the
+// user-api, both fetched in batches so a list of N items costs one query per level instead of N.
+type Resolver struct {
+	DB *gorm.DB
+	// Cache holds the orders fetched by ID, shared with the REST endpoints
+	Cache cache.Cache
+	// Users looks up users in the user-api; nil uses utils.DefaultUserLoader
+	Users *utils.UserLoader
+}
+
+// userOrdersKey identifies the orders of a user field: the user and how many orders were asked for
+type userOrdersKey struct {
+	UserID uint
+	Limit  int
+}
+
+type userOrdersLoaderKey struct{}
+
+type fullPIIKey struct{}
+
+// WithFullPII records in ctx whether the caller may see the CPF, email and phone number of users in full
+func WithFullPII(ctx context.Context, full bool) context.Context {
+	return context.WithValue(ctx, fullPIIKey{}, full)
+}
+
+// presentUser masks the user unless ctx allows full PII. Users are fetched with USER_API_KEY, which
+// may see more than the caller.
+func presentUser(ctx context.Context, user models.User) models.User {
+	if full, _ := ctx.Value(fullPIIKey{}).(bool); full {
+		return user
+	}
+	return user.Masked()
+}
+
+// intArg returns the value of an optional argument, or def when it is explicitly null
+func intArg(value *int, def int) int {
+	if value == nil {
+		return def
+	}
+	return *value
+}
+
+// withLoaders attaches the loaders of one operation to ctx. They live only as long as the operation,
+// so each one sees the orders as they are when it runs.
+func (r *Resolver) withLoaders(ctx context.Context) context.Context {
+	service := r.orderService()
+	loader := utils.NewLoader(func(ctx context.Context, keys []userOrdersKey) (map[userOrdersKey][]models.Order, error) {
+		byLimit := make(map[int][]uint)
+		for _, key := range keys {
+			byLimit[key.Limit] = append(byLimit[key.Limit], key.UserID)
+		}
+		result := make(map[userOrdersKey][]models.Order, len(keys))
+		for limit, userIDs := range byLimit {
+			orders, err := service.GetLatestOrdersByUserIDs(ctx, userIDs, limit)
+			if err != nil {
+				return nil, err
+			}
+			for _, userID := range userIDs {
+				result[userOrdersKey{UserID: userID, Limit: limit}] = orders[userID]
+			}
+		}
+		return result, nil
+	}, batchWindow, 100)
+	return context.WithValue(ctx, userOrdersLoaderKey{}, loader)
+}
+
+// userOrders returns the loader of users' orders attached to ctx by withLoaders
+func (r *Resolver) userOrders(ctx context.Context) *utils.Loader[userOrdersKey, []models.Order] {
+	if loader, ok := ctx.Value(userOrdersLoaderKey{}).(*utils.Loader[userOrdersKey, []models.Order]); ok {
+		return loader
+	}
+	return r.withLoaders(ctx).Value(userOrdersLoaderKey{}).(*utils.Loader[userOrdersKey, []models.Order])
+}
+
+func (r *Resolver) users() *utils.UserLoader {
+	if r.Users != nil {
+		return r.Users
+	}
+	return utils.DefaultUserLoader
+}
+
+func (r *Resolver) orderService() *services.OrderService {
+	return &services.OrderService{DB: r.DB, Cache: r.Cache}
+}
@@ -0,0 +1,121 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.49
+
+import (
+	"context"
+	"errors"
+	"order-api/models"
+	"shared/apierror"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User is the resolver for the user field.
+func (r *orderResolver) User(ctx context.Context, obj *models.Order) (*models.User, error) {
+	if obj.UserID == 0 {
+		return nil, nil
+	}
+	user, err := r.users().Load(ctx, obj.UserID)
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch user", err)
+	}
+	if user == nil {
+		return nil, nil
+	}
+	presented := presentUser(ctx, *user)
+	return &presented, nil
+}
+
+// Order is the resolver for the order field.
+func (r *queryResolver) Order(ctx context.Context, id uint) (*models.Order, error) {
+	order, err := r.orderService().GetOrderByID(ctx, strconv.FormatUint(uint64(id), 10))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch order", err)
+	}
+	return order, nil
+}
+
+// Orders is the resolver for the orders field.
+func (r *queryResolver) Orders(ctx context.Context, userID *uint, status *string, from *time.Time, to *time.Time, limit *int, offset *int) ([]models.Order, error) {
+	query := models.OrderSearchQuery{From: from, To: to, Limit: intArg(limit, defaultListLimit), Offset: intArg(offset, 0)}
+	if err := checkLimit(query.Limit); err != nil {
+		return nil, err
+	}
+	if query.Offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	if userID != nil {
+		query.UserID = *userID
+	}
+	if status != nil {
+		query.Status = *status
+	}
+	return r.orderService().FindOrders(ctx, query)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id uint) (*models.User, error) {
+	user, err := r.users().Load(ctx, id)
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch user", err)
+	}
+	if user == nil {
+		return nil, nil
+	}
+	presented := presentUser(ctx, *user)
+	return &presented, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, ids []uint) ([]models.User, error) {
+	found, err := r.users().LoadMany(ctx, ids)
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch users", err)
+	}
+	users := make([]models.User, 0, len(found))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if user, ok := found[id]; ok && !seen[id] {
+			seen[id] = true
+			users = append(users, presentUser(ctx, user))
+		}
+	}
+	return users, nil
+}
+
+// Orders is the resolver for the orders field.
+func (r *userResolver) Orders(ctx context.Context, obj *models.User, limit *int) ([]models.Order, error) {
+	userLimit := intArg(limit, defaultListLimit)
+	if err := checkLimit(userLimit); err != nil {
+		return nil, err
+	}
+	orders, err := r.userOrders(ctx).Load(ctx, userOrdersKey{UserID: obj.ID, Limit: userLimit})
+	if err != nil {
+		return nil, err
+	}
+	if orders == nil || *orders == nil {
+		return []models.Order{}, nil
+	}
+	return *orders, nil
+}
+
+// Order returns OrderResolver implementation.
+func (r *Resolver) Order() OrderResolver { return &orderResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type orderResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -1,17 +1,33 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"order-api/middleware"
 	"order-api/models"
+	"order-api/ratelimit"
 	"order-api/routes"
+	"order-api/search"
+	"order-api/services"
+	"os"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
+	"shared/config"
+	"shared/database"
+	"shared/events"
+	"shared/logging"
+	"shared/outbox"
+	"shared/server"
+	"shared/tracing"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
 	_ "order-api/docs"
-
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	sharedmiddleware "shared/middleware"
 )
 
 // @title Order API
@@ -25,17 +41,182 @@ import (
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
+	slog.SetDefault(logging.NewLogger())
+
+	shutdownTracing, err := tracing.Init(context.Background(), "order-api", config.GetEnv("OTEL_TRACES_EXPORTER", "none"))
+	if err != nil {
+		panic("failed to configure tracing: " + err.Error())
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := services.InitPseudonymKey(config.GetEnv("ORDER_PSEUDONYM_KEY", "")); err != nil {
+		panic("failed to configure order pseudonymization: " + err.Error())
+	}
+
 	dsn := "host=postgres user=user password=password dbname=orderdb port=5432 sslmode=disable TimeZone=America/Sao_Paulo"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := database.Open(database.ConfigFromEnv(dsn, "orderdb"))
 	if err != nil {
-		panic("failed to connect database")
+		panic(err.Error() + ": " + apierror.RootCause(err).Error())
 	}
 
 	db.AutoMigrate(&models.Order{})
 
-	r := gin.Default()
-	routes.OrderRoutes(r, db)
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	r.Run(":8080")
+	orderSearch := services.SearchService{DB: db, Index: newOrderIndex(db)}
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		indexed, err := orderSearch.Reindex(context.Background(), 500)
+		if err != nil {
+			slog.Error("reindex failed", "indexed", indexed, "error", err.Error())
+			os.Exit(1)
+		}
+		slog.Info("reindex finished", "indexed", indexed)
+		return
+	}
+
+	auditService := audit.Service{DB: db}
+	if err := auditService.Migrate(); err != nil {
+		panic("failed to migrate audit log: " + err.Error())
+	}
+
+	db.AutoMigrate(&models.IdempotencyKey{}, &outbox.Event{})
+
+	orderEvents := newEventBroker()
+	relay := outbox.Relay{
+		DB:           db,
+		Broker:       orderEvents,
+		PollInterval: config.GetEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    100,
+		Retention:    config.GetEnvDuration("OUTBOX_RETENTION", 24*time.Hour),
+	}
+	go relay.Run(context.Background())
+
+	db.AutoMigrate(&models.KnownUser{})
+	userProjection := &services.UserProjectionService{
+		DB:             db,
+		MaxAge:         config.GetEnvDuration("USER_PROJECTION_MAX_AGE", time.Hour),
+		NegativeMaxAge: config.GetEnvDuration("USER_PROJECTION_NEGATIVE_MAX_AGE", 5*time.Second),
+	}
+	userEvents := newUserEventBroker()
+	go func() {
+		for {
+			err := userEvents.Subscribe(context.Background(), "order-api-user-projection", userProjection.HandleUserEvent)
+			slog.Error("user event subscription stopped, retrying", "error", err.Error())
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	db.AutoMigrate(&models.ImportJob{})
+	importService := services.ImportService{DB: db}
+	go importService.MonitorJobs(context.Background())
+
+	db.AutoMigrate(&models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.WebhookDeliveryAttempt{})
+	webhooks := services.WebhookService{
+		DB:           db,
+		MaxAttempts:  config.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		RetryBackoff: config.GetEnvDuration("WEBHOOK_RETRY_BACKOFF", 10*time.Second),
+		MaxBackoff:   config.GetEnvDuration("WEBHOOK_MAX_BACKOFF", time.Hour),
+	}
+	go func() {
+		for {
+			err := orderEvents.Subscribe(context.Background(), "order-api-webhooks", webhooks.HandleOrderEvent)
+			slog.Error("webhook event subscription stopped, retrying", "error", err.Error())
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	go webhooks.Run(context.Background(), config.GetEnvDuration("WEBHOOK_POLL_INTERVAL", time.Second))
+
+	// Subscribe right away so no event is missed while the index is unavailable; HandleOrderEvent
+	// prepares the index and fails the events until it can
+	go func() {
+		for {
+			err := orderEvents.Subscribe(context.Background(), "order-api-search", orderSearch.HandleOrderEvent)
+			slog.Error("search event subscription stopped, retrying", "error", err.Error())
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	idempotencyService := services.IdempotencyService{DB: db}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := idempotencyService.PurgeExpired(context.Background()); err != nil {
+				slog.Error("failed to purge expired idempotency keys", "error", err.Error())
+			}
+		}
+	}()
+
+	r := server.New("order-api")
+
+	limits, err := ratelimit.ParseRouteLimits(config.GetEnv("RATE_LIMITS", "POST /orders=10/1m,default=100/1m"))
+	if err != nil {
+		panic("invalid rate limits: " + err.Error())
+	}
+	r.Use(middleware.RateLimit(newRateLimitStore(), limits))
+
+	timeouts, err := sharedmiddleware.ParseRouteTimeouts(config.GetEnv("REQUEST_TIMEOUTS", "GET /orders/export=0,POST /orders/import=2m,default=10s"))
+	if err != nil {
+		panic("invalid request timeouts: " + err.Error())
+	}
+	r.Use(sharedmiddleware.Timeout(timeouts))
+
+	orderCache := newCache()
+	routes.OrderRoutes(r, db, orderCache, userProjection)
+	routes.AuditRoutes(r, db)
+	routes.WebhookRoutes(r, db)
+	routes.SearchRoutes(r, db, orderSearch.Index)
+	routes.ReportRoutes(r, db)
+	routes.GraphQLRoutes(r, db, orderCache)
+	server.Run(r, ":8080")
+}
+
+func newRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: config.GetEnv("REDIS_ADDR", "redis:6379")})
+}
+
+// newRateLimitStore returns the store selected by RATE_LIMIT_STORE ("memory" or "redis")
+func newRateLimitStore() ratelimit.Store {
+	if config.GetEnv("RATE_LIMIT_STORE", "memory") == "redis" {
+		return ratelimit.NewRedisStore(newRedisClient())
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// newCache returns the cache selected by CACHE_STORE ("memory" or "redis")
+func newCache() cache.Cache {
+	if config.GetEnv("CACHE_STORE", "memory") == "redis" {
+		return cache.NewRedisCache(newRedisClient(), "cache:")
+	}
+	return cache.NewMemoryCache()
+}
+
+// newOrderIndex returns the search backend selected by SEARCH_BACKEND ("postgres" or "elasticsearch")
+func newOrderIndex(db *gorm.DB) search.OrderIndex {
+	if config.GetEnv("SEARCH_BACKEND", "postgres") == "elasticsearch" {
+		client, err := elasticsearch.NewClient(elasticsearch.Config{
+			Addresses: []string{config.GetEnv("ELASTICSEARCH_URL", "http://elasticsearch:9200")},
+		})
+		if err != nil {
+			panic("failed to configure elasticsearch: " + err.Error())
+		}
+		return search.NewElasticsearchIndex(client, config.GetEnv("ORDER_SEARCH_INDEX", "orders"))
+	}
+	return search.NewPostgresIndex(db)
+}
+
+// newUserEventBroker returns the broker carrying the user-api's user events, selected by EVENT_BROKER
+func newUserEventBroker() events.Broker {
+	if config.GetEnv("EVENT_BROKER", "memory") == "redis" {
+		return events.NewRedisStreamBroker(newRedisClient(), config.GetEnv("USER_EVENTS_STREAM", "user-events"))
+	}
+	return events.NewMemoryBroker()
+}
+
+// newEventBroker returns the broker selected by EVENT_BROKER ("memory" or "redis")
+func newEventBroker() events.Broker {
+	if config.GetEnv("EVENT_BROKER", "memory") == "redis" {
+		return events.NewRedisStreamBroker(newRedisClient(), config.GetEnv("ORDER_EVENTS_STREAM", "order-events"))
+	}
+	return events.NewMemoryBroker()
 }
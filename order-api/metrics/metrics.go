@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Number of orders created.",
+	})
+
+	UserVerificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_verification_failures_total",
+		Help: "Number of orders rejected because the user could not be verified, by reason (not_found or error).",
+	}, []string{"reason"})
+
+	UserAPIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "user_api_request_duration_seconds",
+		Help:    "Duration of calls to the user-api by operation and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	UserExpansionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_user_expansion_failures_total",
+		Help: "Number of responses with expand=user returned without users because the user-api failed or timed out.",
+	})
+)
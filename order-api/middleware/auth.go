@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"shared/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CanManageWebhooks reports whether the caller may manage webhook subscriptions
+func CanManageWebhooks(c *gin.Context) bool {
+	return middleware.HasRole(c, middleware.RolesFromEnv("WEBHOOK_AUTHORIZED_ROLES")...)
+}
+
+// CanExportOrders reports whether the caller may export orders
+func CanExportOrders(c *gin.Context) bool {
+	return middleware.HasRole(c, middleware.RolesFromEnv("EXPORT_AUTHORIZED_ROLES")...)
+}
+
+// CanImportOrders reports whether the caller may import orders in bulk
+func CanImportOrders(c *gin.Context) bool {
+	return middleware.HasRole(c, middleware.RolesFromEnv("IMPORT_AUTHORIZED_ROLES")...)
+}
+
+// CanViewUserPII reports whether the caller may see the CPF, email and phone number of users in full.
+// It follows PII_AUTHORIZED_ROLES like the user-api, since users are fetched with USER_API_KEY.
+func CanViewUserPII(c *gin.Context) bool {
+	return middleware.HasRole(c, middleware.RolesFromEnv("PII_AUTHORIZED_ROLES")...)
+}
+
+// CanPseudonymizeOrders reports whether the caller may pseudonymize a user's orders. The user-api
+// authenticates with a service key when erasing a user, so the service role is allowed by default.
+func CanPseudonymizeOrders(c *gin.Context) bool {
+	return middleware.HasRole(c, middleware.RolesFromEnv("PSEUDONYMIZE_AUTHORIZED_ROLES", "admin", "service")...)
+}
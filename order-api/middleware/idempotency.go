@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"order-api/models"
+	"shared/apierror"
+	"shared/middleware"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyStore keeps Idempotency-Key reservations and their responses
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, response []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+// responseRecorder copies the response body while writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Idempotency replays the stored response of requests repeated with the same Idempotency-Key header.
+// Repeats with a different payload are rejected with 422 and repeats of a request still in progress with 409.
+// Server errors and panics release the key so the request can be retried.
+func Idempotency(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader("Idempotency-Key")
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped by client so different clients cannot replay each other's responses
+		key := clientKey(c) + ":" + c.Request.Method + ":" + c.FullPath() + ":" + idempotencyKey
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+		record, created, err := store.Begin(c.Request.Context(), key, fingerprint, ttl)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "idempotency store error", "error", err.Error(), "request_id", middleware.GetRequestID(c))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to process Idempotency-Key"})
+			return
+		}
+
+		if !created {
+			switch {
+			case record.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, apierror.ErrorResponse{Error: "Idempotency-Key was already used with a different payload"})
+			case record.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, apierror.ErrorResponse{Error: "A request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(record.StatusCode, record.ContentType, record.Response)
+				c.Abort()
+			}
+			return
+		}
+
+		// The reservation is settled even when the request was cancelled or timed out, so the key is not
+		// left in progress until it expires
+		settleCtx := context.WithoutCancel(c.Request.Context())
+
+		// A panicking handler never stores a response, so release the key before the panic reaches Recovery
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := store.Release(settleCtx, key); err != nil {
+					slog.ErrorContext(c.Request.Context(), "idempotency store error", "error", err.Error(), "request_id", middleware.GetRequestID(c))
+				}
+				panic(recovered)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			err = store.Release(settleCtx, key)
+		} else {
+			err = store.Complete(settleCtx, key, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "idempotency store error", "error", err.Error(), "request_id", middleware.GetRequestID(c))
+		}
+	}
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
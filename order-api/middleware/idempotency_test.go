@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"order-api/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryIdempotencyStore struct {
+	records map[string]*models.IdempotencyKey
+}
+
+func (s *memoryIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyKey, bool, error) {
+	if record, ok := s.records[key]; ok {
+		return record, false, nil
+	}
+	s.records[key] = &models.IdempotencyKey{Key: key, Fingerprint: fingerprint}
+	return s.records[key], true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, key string, statusCode int, contentType string, response []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.records[key].StatusCode = statusCode
+	s.records[key].ContentType = contentType
+	s.records[key].Response = response
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	delete(s.records, key)
+	return nil
+}
+
+func newIdempotencyRouter(store IdempotencyStore, calls *int) *gin.Engine {
+	router := gin.Default()
+	router.POST("/orders", Idempotency(store, time.Hour), func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusCreated, gin.H{"id": *calls})
+	})
+	return router
+}
+
+func postOrder(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/orders", bytes.NewBufferString(body))
+	req.Header.Set("Idempotency-Key", key)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	calls := 0
+	router := newIdempotencyRouter(&memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}, &calls)
+
+	first := postOrder(router, "abc", `{"user_id":1}`)
+	second := postOrder(router, "abc", `{"user_id":1}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyRejectsDifferentPayload(t *testing.T) {
+	calls := 0
+	router := newIdempotencyRouter(&memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}, &calls)
+
+	postOrder(router, "abc", `{"user_id":1}`)
+	w := postOrder(router, "abc", `{"user_id":2}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestIdempotencyRejectsRequestInProgress(t *testing.T) {
+	calls := 0
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}
+	router := newIdempotencyRouter(store, &calls)
+	store.Begin(context.Background(), "ip:192.0.2.1:POST:/orders:abc", requestFingerprint("POST", "/orders", []byte(`{"user_id":1}`)), time.Hour)
+
+	w := postOrder(router, "abc", `{"user_id":1}`)
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestIdempotencyReleasesKeyWhenHandlerPanics(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/orders", Idempotency(store, time.Hour), func(c *gin.Context) {
+		panic("boom")
+	})
+
+	first := postOrder(router, "abc", `{"user_id":1}`)
+	second := postOrder(router, "abc", `{"user_id":1}`)
+
+	assert.Equal(t, http.StatusInternalServerError, first.Code)
+	assert.Equal(t, http.StatusInternalServerError, second.Code)
+	assert.Empty(t, store.records)
+}
+
+func TestIdempotencyStoresResponseOfCancelledRequests(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Set("cancel", cancel)
+	}, Idempotency(store, time.Hour), func(c *gin.Context) {
+		c.MustGet("cancel").(context.CancelFunc)()
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	w := postOrder(router, "abc", `{"user_id":1}`)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusCreated, store.records["ip:192.0.2.1:POST:/orders:abc"].StatusCode)
+}
+
+func TestIdempotencyScopesAnonymousKeysByIP(t *testing.T) {
+	calls := 0
+	router := newIdempotencyRouter(&memoryIdempotencyStore{records: map[string]*models.IdempotencyKey{}}, &calls)
+
+	post := func(remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/orders", bytes.NewBufferString(`{"user_id":1}`))
+		req.Header.Set("Idempotency-Key", "abc")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	post("10.0.0.1:1234")
+	w := post("10.0.0.2:1234")
+
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+}
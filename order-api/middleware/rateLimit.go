@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"order-api/ratelimit"
+	"shared/apierror"
+	"shared/middleware"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits requests per client and route with token buckets kept in store.
+// Clients are identified by API key, or by IP when anonymous, since client-sent headers can be spoofed.
+// Routes without an entry in limits use limits["default"]; without a default they are not limited.
+func RateLimit(store ratelimit.Store, limits map[string]ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		limit, ok := limits[route]
+		if !ok {
+			if limit, ok = limits["default"]; !ok {
+				c.Next()
+				return
+			}
+			route = "default"
+		}
+
+		result, err := store.Take(c.Request.Context(), clientKey(c)+"|"+route, limit)
+		if err != nil {
+			// Fail open: an unavailable store must not take the API down
+			slog.ErrorContext(c.Request.Context(), "rate limit store error", "error", err.Error(), "request_id", middleware.GetRequestID(c))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		c.Header("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(ceilSeconds(limit.Period)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, apierror.ErrorResponse{Error: "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey identifies the caller by API key name, or by IP for anonymous callers, who all share
+// the anonymous principal
+func clientKey(c *gin.Context) string {
+	if principal := middleware.GetPrincipal(c); principal != middleware.Anonymous {
+		return "key:" + principal.Name
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
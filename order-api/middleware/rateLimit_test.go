@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"order-api/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitKeysAnonymousClientsByIP(t *testing.T) {
+	router := gin.New()
+	router.Use(RateLimit(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{"default": {Requests: 1, Period: time.Minute}}))
+	router.GET("/orders", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(userID, remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/orders", nil)
+		req.Header.Set("X-User-ID", userID)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("1", "10.0.0.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, request("2", "10.0.0.1:1234"))
+	assert.Equal(t, http.StatusOK, request("2", "10.0.0.2:1234"))
+}
@@ -1,6 +0,0 @@
-package models
-
-// ErrorResponse define a estrutura para respostas de erro
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
@@ -0,0 +1,20 @@
+package models
+
+// GraphQLRequest é o corpo de uma requisição ao endpoint GraphQL
+type GraphQLRequest struct {
+	Query         string                 `json:"query" example:"{ order(id: 1) { id totalValue user { name } } }"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse é a resposta do endpoint GraphQL; Data pode vir preenchido em parte junto com Errors
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError é um erro de uma resposta GraphQL, com o caminho do campo que falhou
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// IdempotencyKey guarda a resposta de uma requisição identificada pelo header Idempotency-Key
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	// StatusCode is zero while the original request is still being processed
+	StatusCode  int
+	ContentType string
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	ImportRowCreated = "created"
+	ImportRowInvalid = "invalid"
+	ImportRowFailed  = "failed"
+
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// ImportRowResult é o resultado da importação de uma linha; Row começa em 1 e não conta o cabeçalho do CSV
+type ImportRowResult struct {
+	Row     int    `json:"row"`
+	Status  string `json:"status"`
+	OrderID uint   `json:"order_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImportReport resume uma importação de pedidos, com o resultado de cada linha
+type ImportReport struct {
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []ImportRowResult `json:"results"`
+}
+
+// ImportJob é uma importação grande executada em segundo plano; o relatório fica disponível ao terminar
+type ImportJob struct {
+	ID         string            `json:"id" gorm:"primaryKey"`
+	Status     string            `json:"status" gorm:"index"`
+	Format     string            `json:"format"`
+	Actor      string            `json:"actor"`
+	Total      int               `json:"total"`
+	Created    int               `json:"created"`
+	Failed     int               `json:"failed"`
+	Results    []ImportRowResult `json:"results,omitempty" gorm:"type:jsonb;serializer:json"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	// HeartbeatAt is refreshed while the job runs; a stale heartbeat means the instance running it stopped
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
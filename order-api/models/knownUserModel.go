@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// KnownUser é a projeção local dos usuários da user-api, mantida pelos eventos de usuário
+type KnownUser struct {
+	UserID uint `gorm:"primaryKey;autoIncrement:false"`
+	Exists bool
+	// LastEventAt is when the last applied event occurred, used to ignore events delivered out of order
+	LastEventAt time.Time
+	// SyncedAt is when the entry was last confirmed by an event or by the user-api
+	SyncedAt time.Time
+}
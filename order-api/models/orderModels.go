@@ -2,6 +2,11 @@ package models
 
 import "time"
 
+const (
+	OrderStatusCreated   = "created"
+	OrderStatusCancelled = "cancelled"
+)
+
 type Order struct {
 	ID              uint       `json:"id" gorm:"primaryKey"`
 	UserID          uint       `json:"user_id" validate:"required"`
@@ -9,8 +14,11 @@ type Order struct {
 	ItemQuantity    int        `json:"item_quantity" validate:"required"`
 	ItemPrice       float64    `json:"item_price" validate:"required"`
 	TotalValue      float64    `json:"total_value" validate:"required"`
+	Status          string     `json:"status" gorm:"default:created"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       *time.Time `json:"updated_at,omitempty" gorm:"default:null"`
+	// UserPseudonym replaces UserID once the user's personal data has been erased
+	UserPseudonym string `json:"user_pseudonym,omitempty" gorm:"index"`
 }
 
 type OrderRequest struct {
@@ -20,3 +28,17 @@ type OrderRequest struct {
 	ItemPrice       float64 `json:"item_price" validate:"required"`
 	TotalValue      float64 `json:"total_value" validate:"required"`
 }
+
+// PseudonymizeResponse informa quantos pedidos foram pseudonimizados
+type PseudonymizeResponse struct {
+	OrdersPseudonymized int64 `json:"orders_pseudonymized"`
+}
+
+// ExpandedOrder é um pedido com os dados do usuário embutidos (?expand=user). User fica vazio em pedidos
+// pseudonimizados ou de usuários que não existem mais; Partial indica que a user-api não respondeu a tempo
+// e os dados do usuário estão faltando
+type ExpandedOrder struct {
+	Order
+	User    *User `json:"user"`
+	Partial bool  `json:"partial"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	ReportGroupByDay   = "day"
+	ReportGroupByWeek  = "week"
+	ReportGroupByMonth = "month"
+	ReportGroupByUser  = "user"
+)
+
+// OrderReportFilter seleciona os pedidos agregados por um relatório; From é inclusivo e To exclusivo
+type OrderReportFilter struct {
+	GroupBy string
+	From    *time.Time
+	To      *time.Time
+	// Limit limita o número de linhas dos relatórios agrupados por usuário
+	Limit int
+}
+
+// OrderReportRow agrega os pedidos de um período ou de um usuário
+type OrderReportRow struct {
+	Period        *time.Time `json:"period,omitempty"`
+	UserID        *uint      `json:"user_id,omitempty"`
+	UserPseudonym string     `json:"user_pseudonym,omitempty"`
+	OrderCount    int64      `json:"order_count"`
+	Revenue       float64    `json:"revenue"`
+	AverageTicket float64    `json:"average_ticket"`
+}
+
+// OrderReport é o relatório de pedidos agrupado por período ou por usuário, com os totais do intervalo
+type OrderReport struct {
+	GroupBy string           `json:"group_by"`
+	From    *time.Time       `json:"from,omitempty"`
+	To      *time.Time       `json:"to,omitempty"`
+	Rows    []OrderReportRow `json:"rows"`
+	Totals  OrderReportRow   `json:"totals"`
+}
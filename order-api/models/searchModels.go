@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// OrderSearchQuery selects orders by item description and filters
+type OrderSearchQuery struct {
+	Text     string
+	UserID   uint
+	Status   string
+	MinTotal float64
+	MaxTotal float64
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Offset   int
+}
+
+// OrderSearchHit é um pedido encontrado na busca, com os trechos da descrição que casaram com o termo
+type OrderSearchHit struct {
+	Order
+	Score      float64  `json:"score"`
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+// OrderSearchResult é uma página de resultados da busca e o total de pedidos encontrados
+type OrderSearchResult struct {
+	Total int64            `json:"total"`
+	Hits  []OrderSearchHit `json:"hits"`
+}
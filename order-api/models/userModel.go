@@ -0,0 +1,36 @@
+package models
+
+import (
+	"shared/pii"
+	"strings"
+	"time"
+)
+
+// User é um usuário como devolvido pela user-api; CPF, email e telefone vêm mascarados a menos que
+// USER_API_KEY tenha um papel autorizado a vê-los
+type User struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	CPF          string     `json:"cpf"`
+	Email        string     `json:"email"`
+	PhoneNumber  string     `json:"phone_number"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+}
+
+// Masked returns the user with CPF, email and phone number masked as the user-api masks them. USER_API_KEY
+// may see them in full, so users are masked again for callers that may not; values the user-api already
+// masked are kept.
+func (u User) Masked() User {
+	mask := func(value string, masker func(string) string) string {
+		if value == "" || strings.Contains(value, "*") {
+			return value
+		}
+		return masker(value)
+	}
+	u.CPF = mask(u.CPF, pii.MaskCPF)
+	u.Email = mask(u.Email, pii.MaskEmail)
+	u.PhoneNumber = mask(u.PhoneNumber, pii.MaskPhone)
+	return u
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+const (
+	WebhookDeliveryPending = "pending"
+	// WebhookDeliveryInFlight marks deliveries leased by a worker until next_attempt_at
+	WebhookDeliveryInFlight  = "in_flight"
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryDead marks deliveries that exhausted their retries (the dead-letter list)
+	WebhookDeliveryDead = "dead"
+)
+
+// WebhookSubscription registra um parceiro que recebe os eventos de pedidos por HTTP
+type WebhookSubscription struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types" gorm:"serializer:json"`
+	Secret     string    `json:"-"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookSubscriptionCreated is returned once on registration, the only time the secret is shown
+type WebhookSubscriptionCreated struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type WebhookRequest struct {
+	// URL must be http or https; deliveries to private, loopback and link-local addresses are refused
+	URL string `json:"url" validate:"required,http_url"`
+	// EventTypes lists the events to deliver; "*" selects every event
+	EventTypes []string `json:"event_types" validate:"required,min=1,dive,oneof=* OrderCreated OrderUpdated OrderCancelled OrderDeleted"`
+	// Secret signs the deliveries; a random one is generated when empty
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery é o envio de um evento para uma assinatura, com o histórico das tentativas
+type WebhookDelivery struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint   `json:"subscription_id" gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	EventID        string `json:"event_id" gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	EventType      string `json:"event_type"`
+	Payload        string `json:"-" gorm:"type:jsonb"`
+	Status         string `json:"status" gorm:"index"`
+	Attempts       int    `json:"attempts"`
+	// AttemptsBeforeRedelivery is the number of attempts made before the last redelivery; the retry
+	// limit and the backoff count only the attempts after it
+	AttemptsBeforeRedelivery int        `json:"attempts_before_redelivery,omitempty"`
+	NextAttemptAt            time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode           int        `json:"last_status_code,omitempty"`
+	LastError                string     `json:"last_error,omitempty"`
+	DeliveredAt              *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt                time.Time  `json:"created_at"`
+	UpdatedAt                time.Time  `json:"updated_at"`
+}
+
+// WebhookDeliveryAttempt registra uma tentativa de envio de uma entrega e o seu resultado
+type WebhookDeliveryAttempt struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	DeliveryID uint      `json:"delivery_id" gorm:"index"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	first, _ := store.Take(context.Background(), "client", limit)
+	second, _ := store.Take(context.Background(), "client", limit)
+	third, _ := store.Take(context.Background(), "client", limit)
+
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 1, first.Remaining)
+	assert.True(t, second.Allowed)
+	assert.Equal(t, 0, second.Remaining)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, 30*time.Second, third.RetryAfter)
+	assert.Equal(t, time.Minute, third.Reset)
+
+	now = now.Add(30 * time.Second)
+	refilled, _ := store.Take(context.Background(), "client", limit)
+	assert.True(t, refilled.Allowed)
+
+	other, _ := store.Take(context.Background(), "other", limit)
+	assert.True(t, other.Allowed)
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	limits, err := ParseRouteLimits("POST /orders=10/1m, default=100/1s")
+
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Period: time.Minute}, limits["POST /orders"])
+	assert.Equal(t, Limit{Requests: 100, Period: time.Second}, limits["default"])
+
+	_, err = ParseRouteLimits("POST /orders=ten/1m")
+	assert.Error(t, err)
+	_, err = ParseRouteLimits("default=100/500us")
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket that holds up to Requests tokens and refills them evenly over Period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result describes the state of a bucket after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available when the request is not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets and takes one token per request
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ParseLimit parses a limit formatted as "<requests>/<period>", e.g. "10/1m".
+// Periods shorter than a millisecond are rejected because the Redis store works in milliseconds.
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit requests %q", parts[0])
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period < time.Millisecond {
+		return Limit{}, fmt.Errorf("invalid rate limit period %q", parts[1])
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// ParseRouteLimits parses per-route limits formatted as "<METHOD> <route>=<limit>" separated by commas.
+// The special route "default" applies to routes without their own limit.
+// Example: "POST /orders=10/1m,default=100/1m"
+func ParseRouteLimits(value string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		index := strings.LastIndex(entry, "=")
+		if index < 0 {
+			return nil, fmt.Errorf("invalid route rate limit %q", entry)
+		}
+		limit, err := ParseLimit(entry[index+1:])
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.Join(strings.Fields(entry[:index]), " ")] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a token bucket atomically.
+// KEYS[1] = bucket key; ARGV = capacity, refill rate in tokens per millisecond, current time in milliseconds.
+// Returns {allowed, tokens left * 1000}.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil then
+	tokens = capacity
+	updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+// RedisStore keeps token buckets in Redis so limits are shared between instances
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{Client: client, Prefix: "ratelimit:"}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	capacity := float64(limit.Requests)
+	ratePerMs := capacity / float64(limit.Period.Milliseconds())
+
+	values, err := takeScript.Run(ctx, s.Client, []string{s.Prefix + key},
+		limit.Requests, ratePerMs, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens := float64(values[1]) / 1000
+	rate := capacity / limit.Period.Seconds()
+	result := Result{
+		Allowed:   values[0] == 1,
+		Limit:     limit.Requests,
+		Remaining: int(tokens),
+		Reset:     secondsToDuration((capacity - tokens) / rate),
+	}
+	if !result.Allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return result, nil
+}
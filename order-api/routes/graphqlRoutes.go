@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"order-api/controllers"
+	"shared/cache"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GraphQLRoutes(r *gin.Engine, db *gorm.DB, orderCache cache.Cache) {
+	r.POST("/graphql", controllers.GraphQL(db, orderCache))
+	r.GET("/graphql/schema", controllers.GraphQLSchema())
+}
@@ -2,16 +2,27 @@ package routes
 
 import (
 	"order-api/controllers"
+	"order-api/middleware"
+	"order-api/services"
+	"shared/cache"
+	"shared/config"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func OrderRoutes(r *gin.Engine, db *gorm.DB) {
+func OrderRoutes(r *gin.Engine, db *gorm.DB, orderCache cache.Cache, userProjection *services.UserProjectionService) {
 	r.GET("/orders", controllers.GetOrders(db))
-	r.GET("/orders/:id", controllers.GetOrderByID(db))
+	r.GET("/orders/export", controllers.ExportOrders(db))
+	r.GET("/orders/:id", controllers.GetOrderByID(db, orderCache))
 	r.GET("/users/:id/orders", controllers.GetOrdersByUserID(db))
-	r.POST("/orders", controllers.CreateOrder(db))
-	r.PUT("/orders/:id", controllers.UpdateOrder(db))
-	r.DELETE("/orders/:id", controllers.DeleteOrder(db))
+	idempotency := middleware.Idempotency(&services.IdempotencyService{DB: db}, config.GetEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour))
+	r.POST("/orders", idempotency, controllers.CreateOrder(db, userProjection))
+	r.POST("/orders/import", controllers.ImportOrders(db, userProjection))
+	r.GET("/orders/import/:id", controllers.GetImportJob(db))
+	r.PUT("/orders/:id", controllers.UpdateOrder(db, orderCache))
+	r.DELETE("/orders/:id", controllers.DeleteOrder(db, orderCache))
+	r.POST("/orders/:id/cancel", controllers.CancelOrder(db, orderCache))
+	r.POST("/users/:id/orders/pseudonymize", controllers.PseudonymizeUserOrders(db, orderCache))
 }
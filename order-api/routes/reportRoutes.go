@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"order-api/controllers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ReportRoutes(r *gin.Engine, db *gorm.DB) {
+	r.GET("/reports/orders", controllers.GetOrderReport(db))
+}
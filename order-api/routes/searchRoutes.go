@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"order-api/controllers"
+	"order-api/search"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SearchRoutes(r *gin.Engine, db *gorm.DB, index search.OrderIndex) {
+	r.GET("/orders/search", controllers.SearchOrders(db, index))
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"order-api/controllers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func WebhookRoutes(r *gin.Engine, db *gorm.DB) {
+	r.POST("/webhooks", controllers.CreateWebhook(db))
+	r.GET("/webhooks", controllers.GetWebhooks(db))
+	r.GET("/webhooks/dead-letters", controllers.GetWebhookDeadLetters(db))
+	r.GET("/webhooks/:id", controllers.GetWebhookByID(db))
+	r.DELETE("/webhooks/:id", controllers.DeleteWebhook(db))
+	r.GET("/webhooks/:id/deliveries", controllers.GetWebhookDeliveries(db))
+	r.GET("/webhooks/deliveries/:id/attempts", controllers.GetWebhookDeliveryAttempts(db))
+	r.POST("/webhooks/deliveries/:id/redeliver", controllers.RedeliverWebhook(db))
+}
@@ -0,0 +1,240 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-api/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// orderMapping is the mapping of the orders index; item_description is analyzed for full-text search
+const orderMapping = `{
+	"mappings": {
+		"properties": {
+			"id":               {"type": "long"},
+			"user_id":          {"type": "long"},
+			"item_description": {"type": "text", "fields": {"keyword": {"type": "keyword", "ignore_above": 256}}},
+			"item_quantity":    {"type": "integer"},
+			"item_price":       {"type": "double"},
+			"total_value":      {"type": "double"},
+			"status":           {"type": "keyword"},
+			"created_at":       {"type": "date"},
+			"updated_at":       {"type": "date"},
+			"user_pseudonym":   {"type": "keyword"}
+		}
+	}
+}`
+
+// ElasticsearchIndex indexes orders in Elasticsearch 7. Documents use external versions, so a write
+// older than the indexed document is ignored.
+type ElasticsearchIndex struct {
+	client *elasticsearch.Client
+	index  string
+}
+
+func NewElasticsearchIndex(client *elasticsearch.Client, index string) *ElasticsearchIndex {
+	return &ElasticsearchIndex{client: client, index: index}
+}
+
+// EnsureIndex creates the index with its mapping when it does not exist
+func (i *ElasticsearchIndex) EnsureIndex(ctx context.Context) error {
+	res, err := i.client.Indices.Exists([]string{i.index}, i.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	res, err = i.client.Indices.Create(i.index,
+		i.client.Indices.Create.WithContext(ctx),
+		i.client.Indices.Create.WithBody(strings.NewReader(orderMapping)))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() && !strings.Contains(res.String(), "resource_already_exists_exception") {
+		return fmt.Errorf("failed to create index %s: %s", i.index, res.String())
+	}
+	return nil
+}
+
+// Index writes orders with the bulk API
+func (i *ElasticsearchIndex) Index(ctx context.Context, orders []models.Order, version time.Time) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, order := range orders {
+		action := map[string]interface{}{"index": map[string]interface{}{
+			"_index":       i.index,
+			"_id":          strconv.FormatUint(uint64(order.ID), 10),
+			"version":      version.UnixNano(),
+			"version_type": "external_gte",
+		}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(order); err != nil {
+			return err
+		}
+	}
+
+	res, err := i.client.Bulk(&body, i.client.Bulk.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("bulk index failed: %s", res.String())
+	}
+
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return err
+	}
+	if !response.Errors {
+		return nil
+	}
+
+	var errs []error
+	for _, item := range response.Items {
+		for _, result := range item {
+			// 409 means the index already holds a newer version of the order
+			if result.Status >= 300 && result.Status != http.StatusConflict {
+				errs = append(errs, fmt.Errorf("failed to index order %s: %s", result.ID, result.Error))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (i *ElasticsearchIndex) Delete(ctx context.Context, id uint, version time.Time) error {
+	res, err := i.client.Delete(i.index, strconv.FormatUint(uint64(id), 10),
+		i.client.Delete.WithContext(ctx),
+		i.client.Delete.WithVersion(int(version.UnixNano())),
+		i.client.Delete.WithVersionType("external_gte"))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusConflict {
+		return fmt.Errorf("failed to delete order %d: %s", id, res.String())
+	}
+	return nil
+}
+
+// Search matches item_description with fuzziness AUTO, so small typos still find the order
+func (i *ElasticsearchIndex) Search(ctx context.Context, query models.OrderSearchQuery) (*models.OrderSearchResult, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(searchRequest(query)); err != nil {
+		return nil, err
+	}
+
+	res, err := i.client.Search(
+		i.client.Search.WithContext(ctx),
+		i.client.Search.WithIndex(i.index),
+		i.client.Search.WithBody(&body),
+		i.client.Search.WithTrackTotalHits(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("search failed: %s", res.String())
+	}
+	return decodeSearchResponse(res)
+}
+
+func searchRequest(query models.OrderSearchQuery) map[string]interface{} {
+	must := []interface{}{map[string]interface{}{"match_all": map[string]interface{}{}}}
+	if query.Text != "" {
+		must = []interface{}{map[string]interface{}{"match": map[string]interface{}{
+			"item_description": map[string]interface{}{"query": query.Text, "fuzziness": "AUTO"},
+		}}}
+	}
+
+	var filter []interface{}
+	if query.UserID != 0 {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"user_id": query.UserID}})
+	}
+	if query.Status != "" {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"status": query.Status}})
+	}
+	total := map[string]interface{}{}
+	if query.MinTotal != 0 {
+		total["gte"] = query.MinTotal
+	}
+	if query.MaxTotal != 0 {
+		total["lte"] = query.MaxTotal
+	}
+	if len(total) > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"total_value": total}})
+	}
+	created := map[string]interface{}{}
+	if query.From != nil {
+		created["gte"] = query.From.Format(time.RFC3339Nano)
+	}
+	if query.To != nil {
+		created["lt"] = query.To.Format(time.RFC3339Nano)
+	}
+	if len(created) > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"created_at": created}})
+	}
+
+	return map[string]interface{}{
+		"from":  query.Offset,
+		"size":  query.Limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"must": must, "filter": filter}},
+		"sort":  []interface{}{"_score", map[string]interface{}{"created_at": "desc"}},
+		// html escapes the description around the <em> tags, so stored markup is never returned live
+		"highlight": map[string]interface{}{
+			"encoder": "html",
+			"fields":  map[string]interface{}{"item_description": map[string]interface{}{}},
+		},
+	}
+}
+
+func decodeSearchResponse(res *esapi.Response) (*models.OrderSearchResult, error) {
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Score     float64             `json:"_score"`
+				Source    models.Order        `json:"_source"`
+				Highlight map[string][]string `json:"highlight"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	result := &models.OrderSearchResult{Total: response.Hits.Total.Value, Hits: make([]models.OrderSearchHit, len(response.Hits.Hits))}
+	for n, hit := range response.Hits.Hits {
+		result.Hits[n] = models.OrderSearchHit{Order: hit.Source, Score: hit.Score, Highlights: hit.Highlight["item_description"]}
+	}
+	return result, nil
+}
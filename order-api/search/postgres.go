@@ -0,0 +1,103 @@
+package search
+
+import (
+	"context"
+	"html"
+	"order-api/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresIndex searches the orders table directly with ILIKE, for environments without Elasticsearch.
+// Matching is by substring only: there is no fuzzy matching and all hits have a zero score.
+type PostgresIndex struct {
+	DB *gorm.DB
+}
+
+func NewPostgresIndex(db *gorm.DB) *PostgresIndex {
+	return &PostgresIndex{DB: db}
+}
+
+func (i *PostgresIndex) EnsureIndex(ctx context.Context) error {
+	return nil
+}
+
+// Index does nothing; the orders table is the index
+func (i *PostgresIndex) Index(ctx context.Context, orders []models.Order, version time.Time) error {
+	return nil
+}
+
+// Delete does nothing; the orders table is the index
+func (i *PostgresIndex) Delete(ctx context.Context, id uint, version time.Time) error {
+	return nil
+}
+
+func (i *PostgresIndex) Search(ctx context.Context, query models.OrderSearchQuery) (*models.OrderSearchResult, error) {
+	db := i.DB.WithContext(ctx).Model(&models.Order{}).Scopes(FilterOrders(query))
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	if err := db.Order("created_at DESC").Limit(query.Limit).Offset(query.Offset).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.OrderSearchResult{Total: total, Hits: make([]models.OrderSearchHit, len(orders))}
+	for n, order := range orders {
+		result.Hits[n] = models.OrderSearchHit{Order: order, Highlights: highlight(order.ItemDescription, query.Text)}
+	}
+	return result, nil
+}
+
+// FilterOrders restricts a query on orders to the text and filters of query, ignoring its pagination
+func FilterOrders(query models.OrderSearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if query.Text != "" {
+			db = db.Where("item_description ILIKE ?", "%"+escapeLike(query.Text)+"%")
+		}
+		if query.UserID != 0 {
+			db = db.Where("user_id = ?", query.UserID)
+		}
+		if query.Status != "" {
+			db = db.Where("status = ?", query.Status)
+		}
+		if query.MinTotal != 0 {
+			db = db.Where("total_value >= ?", query.MinTotal)
+		}
+		if query.MaxTotal != 0 {
+			db = db.Where("total_value <= ?", query.MaxTotal)
+		}
+		if query.From != nil {
+			db = db.Where("created_at >= ?", *query.From)
+		}
+		if query.To != nil {
+			db = db.Where("created_at < ?", *query.To)
+		}
+		return db
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// highlight wraps the first case-insensitive occurrence of term in text with <em> tags and escapes the
+// rest as HTML, like Elasticsearch does with the html encoder
+func highlight(text, term string) []string {
+	if term == "" {
+		return nil
+	}
+	lowerText, lowerTerm := strings.ToLower(text), strings.ToLower(term)
+	start := strings.Index(lowerText, lowerTerm)
+	// offsets in the lowercased text only match the original when lowercasing kept the byte length
+	if start < 0 || len(lowerText) != len(text) {
+		return nil
+	}
+	end := start + len(lowerTerm)
+	return []string{html.EscapeString(text[:start]) + "<em>" + html.EscapeString(text[start:end]) + "</em>" + html.EscapeString(text[end:])}
+}
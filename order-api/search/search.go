@@ -0,0 +1,17 @@
+package search
+
+import (
+	"context"
+	"order-api/models"
+	"time"
+)
+
+// OrderIndex keeps a searchable copy of the orders. Writes carry a version, the time of the change,
+// so an index never goes back to an older state when changes arrive out of order.
+type OrderIndex interface {
+	// EnsureIndex prepares the index before the first write
+	EnsureIndex(ctx context.Context) error
+	Index(ctx context.Context, orders []models.Order, version time.Time) error
+	Delete(ctx context.Context, id uint, version time.Time) error
+	Search(ctx context.Context, query models.OrderSearchQuery) (*models.OrderSearchResult, error)
+}
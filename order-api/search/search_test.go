@@ -0,0 +1,43 @@
+package search
+
+import (
+	"encoding/json"
+	"order-api/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, []string{"Blue <em>Notebook</em> A5"}, highlight("Blue Notebook A5", "notebook"))
+	assert.Equal(t, []string{"&lt;script&gt; <em>Notebook</em> &amp; pen"}, highlight("<script> Notebook & pen", "notebook"))
+	assert.Nil(t, highlight("Blue Notebook A5", "pen"))
+	assert.Nil(t, highlight("Blue Notebook A5", ""))
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `100\% cotton\_shirt`, escapeLike("100% cotton_shirt"))
+}
+
+func TestSearchRequest(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := searchRequest(models.OrderSearchQuery{Text: "notebok", UserID: 7, MinTotal: 10, From: &from, Limit: 20, Offset: 40})
+
+	body, err := json.Marshal(request)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"from": 40,
+		"size": 20,
+		"query": {"bool": {
+			"must": [{"match": {"item_description": {"query": "notebok", "fuzziness": "AUTO"}}}],
+			"filter": [
+				{"term": {"user_id": 7}},
+				{"range": {"total_value": {"gte": 10}}},
+				{"range": {"created_at": {"gte": "2024-01-01T00:00:00Z"}}}
+			]
+		}},
+		"sort": ["_score", {"created_at": "desc"}],
+		"highlight": {"encoder": "html", "fields": {"item_description": {}}}
+	}`, string(body))
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"order-api/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyService struct {
+	DB *gorm.DB
+}
+
+// Begin reserves key for a new request. When the key is already taken it returns the existing
+// record and false, so the caller can replay its response or reject the request.
+func (s *IdempotencyService) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	if err := s.DB.WithContext(ctx).Where("key = ? AND expires_at <= ?", key, now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	record := models.IdempotencyKey{Key: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	result := s.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &record, true, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := s.DB.WithContext(ctx).First(&existing, "key = ?", key).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+// Complete stores the response of the request that reserved key
+func (s *IdempotencyService) Complete(ctx context.Context, key string, statusCode int, contentType string, response []byte) error {
+	return s.DB.WithContext(ctx).Model(&models.IdempotencyKey{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"response":     response,
+	}).Error
+}
+
+// Release frees key so the request can be retried
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	return s.DB.WithContext(ctx).Where("key = ?", key).Delete(&models.IdempotencyKey{}).Error
+}
+
+// PurgeExpired deletes every expired key
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) error {
+	return s.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"order-api/metrics"
+	"order-api/models"
+	"os"
+	"shared/apierror"
+	"shared/audit"
+	"shared/config"
+	"shared/events"
+	"shared/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// importColumns are the columns an import CSV must have, in any order
+var importColumns = []string{"user_id", "item_description", "item_quantity", "item_price", "total_value"}
+
+// ImportRow is an order read from an import file, or the reason the row could not be read
+type ImportRow struct {
+	Row   int
+	Order models.Order
+	Err   error
+}
+
+// ImportReader streams the rows of a CSV (with a header line) or NDJSON import. Malformed rows are
+// returned with their error; only an unreadable file or a CSV without the required columns fails.
+type ImportReader struct {
+	next func() (ImportRow, error)
+	rows int
+}
+
+// NewImportReader reads the CSV header, if any, and returns a reader for the rows that follow
+func NewImportReader(r io.Reader, format string) (*ImportReader, error) {
+	switch format {
+	case models.ImportFormatCSV:
+		return newImportCSVReader(r)
+	case models.ImportFormatNDJSON:
+		return newImportNDJSONReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// Next returns the next row, or io.EOF once the file is exhausted
+func (r *ImportReader) Next() (ImportRow, error) {
+	row, err := r.next()
+	if err != nil {
+		return row, err
+	}
+	r.rows++
+	row.Row = r.rows
+	return row, nil
+}
+
+func newImportCSVReader(r io.Reader) (*ImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing CSV column %q", name)
+		}
+	}
+
+	return &ImportReader{next: func() (ImportRow, error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return ImportRow{Err: parseErr.Err}, nil
+		}
+		if err != nil {
+			return ImportRow{}, err
+		}
+		var row ImportRow
+		row.Order, row.Err = orderFromCSV(record, columns)
+		return row, nil
+	}}, nil
+}
+
+func orderFromCSV(record []string, columns map[string]int) (models.Order, error) {
+	field := func(name string) string {
+		return strings.TrimSpace(record[columns[name]])
+	}
+
+	var order models.Order
+	userID, err := strconv.ParseUint(field("user_id"), 10, 32)
+	if err != nil {
+		return order, errors.New("user_id: invalid number")
+	}
+	quantity, err := strconv.Atoi(field("item_quantity"))
+	if err != nil {
+		return order, errors.New("item_quantity: invalid number")
+	}
+	price, err := strconv.ParseFloat(field("item_price"), 64)
+	if err != nil {
+		return order, errors.New("item_price: invalid number")
+	}
+	total, err := strconv.ParseFloat(field("total_value"), 64)
+	if err != nil {
+		return order, errors.New("total_value: invalid number")
+	}
+
+	order.UserID = uint(userID)
+	order.ItemDescription = field("item_description")
+	order.ItemQuantity = quantity
+	order.ItemPrice = price
+	order.TotalValue = total
+	return order, nil
+}
+
+func newImportNDJSONReader(r io.Reader) *ImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &ImportReader{next: func() (ImportRow, error) {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var row ImportRow
+			var request models.OrderRequest
+			if err := json.Unmarshal(line, &request); err != nil {
+				row.Err = errors.New("invalid JSON")
+			} else {
+				row.Order = models.Order{
+					UserID:          request.UserID,
+					ItemDescription: request.ItemDescription,
+					ItemQuantity:    request.ItemQuantity,
+					ItemPrice:       request.ItemPrice,
+					TotalValue:      request.TotalValue,
+				}
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return ImportRow{}, err
+		}
+		return ImportRow{}, io.EOF
+	}}
+}
+
+// ImportFile is an upload spooled to a temporary file, so it can be checked and counted before the
+// import starts without holding the rows in memory
+type ImportFile struct {
+	file   *os.File
+	Format string
+	// Rows is the number of rows after the CSV header, malformed ones included
+	Rows int
+}
+
+// SpoolImport copies r to a temporary file and reads it once to count the rows. It fails, before
+// anything is imported, when r cannot be read or the file cannot be parsed. Close removes the file.
+func SpoolImport(r io.Reader, format string) (*ImportFile, error) {
+	file, err := os.CreateTemp("", "order-import-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &ImportFile{file: file, Format: format}
+	if _, err := io.Copy(file, r); err != nil {
+		spooled.Close()
+		return nil, err
+	}
+
+	reader, err := spooled.Reader()
+	if err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	for {
+		if _, err = reader.Next(); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		spooled.Close()
+		return nil, err
+	}
+	spooled.Rows = reader.rows
+	return spooled, nil
+}
+
+// Reader returns a reader positioned at the first row of the file
+func (f *ImportFile) Reader() (*ImportReader, error) {
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return NewImportReader(bufio.NewReader(f.file), f.Format)
+}
+
+func (f *ImportFile) Close() error {
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
+
+// importVerifyAttempts and importVerifyBackoff bound the retries of a failed user check; the rows of
+// a chunk fail only once every attempt has failed
+var (
+	importVerifyAttempts = 3
+	importVerifyBackoff  = 500 * time.Millisecond
+)
+
+// importJobHeartbeat is how often a running job records that it is alive. A job whose heartbeat is
+// older than three intervals was interrupted and is marked as failed by FailInterruptedJobs.
+var importJobHeartbeat = config.GetEnvDuration("IMPORT_JOB_HEARTBEAT", 15*time.Second)
+
+type ImportService struct {
+	DB *gorm.DB
+	// Audit identifies the actor and request recorded in the audit log for the imported orders
+	Audit audit.Metadata
+	// ChunkSize is the number of orders inserted per transaction
+	ChunkSize int
+	// UserProjection checks that the users of the rows exist; required by Import
+	UserProjection *UserProjectionService
+}
+
+// Import reads the rows in chunks of ChunkSize; for each chunk it validates the rows with the rules of
+// OrderService.CreateOrder, checks their users together and inserts the valid orders in one transaction.
+// A failed chunk fails only its rows. An error reading rows stops the import and is returned with the
+// report of the rows read so far.
+func (s *ImportService) Import(ctx context.Context, rows *ImportReader) (*models.ImportReport, error) {
+	report := &models.ImportReport{Results: []models.ImportRowResult{}}
+	defer func() {
+		report.Total = len(report.Results)
+		report.Failed = report.Total - report.Created
+		metrics.OrdersCreated.Add(float64(report.Created))
+	}()
+
+	chunkSize := max(s.ChunkSize, 1)
+	chunk := make([]ImportRow, 0, chunkSize)
+	for {
+		row, err := rows.Next()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return report, err
+		}
+		if err == nil {
+			chunk = append(chunk, row)
+			if len(chunk) < chunkSize {
+				continue
+			}
+		}
+		if len(chunk) > 0 {
+			report.Results = append(report.Results, s.importChunk(ctx, chunk)...)
+			for _, result := range report.Results[len(report.Results)-len(chunk):] {
+				if result.Status == models.ImportRowCreated {
+					report.Created++
+				}
+			}
+			chunk = chunk[:0]
+		}
+		if err != nil {
+			return report, nil
+		}
+	}
+}
+
+func (s *ImportService) importChunk(ctx context.Context, rows []ImportRow) []models.ImportRowResult {
+	results := make([]models.ImportRowResult, len(rows))
+
+	var valid []int
+	userIDs := make(map[uint]bool)
+	for i := range rows {
+		results[i] = models.ImportRowResult{Row: rows[i].Row, Status: models.ImportRowInvalid}
+		if rows[i].Err != nil {
+			results[i].Error = rows[i].Err.Error()
+			continue
+		}
+		if err := validate.Struct(&rows[i].Order); err != nil {
+			results[i].Error = validation.Error(err).Error()
+			continue
+		}
+		valid = append(valid, i)
+		userIDs[rows[i].Order.UserID] = true
+	}
+	if len(valid) == 0 {
+		return results
+	}
+
+	ids := make([]uint, 0, len(userIDs))
+	for id := range userIDs {
+		ids = append(ids, id)
+	}
+	exists, err := s.verifyUsers(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to verify users of import", "first_row", rows[0].Row, "error", err.Error())
+	}
+
+	var pending []int
+	for _, i := range valid {
+		switch {
+		case err != nil:
+			metrics.UserVerificationFailures.WithLabelValues("error").Inc()
+			results[i].Status = models.ImportRowFailed
+			results[i].Error = "failed to verify user ID"
+		case !exists[rows[i].Order.UserID]:
+			metrics.UserVerificationFailures.WithLabelValues("not_found").Inc()
+			results[i].Error = "invalid user ID"
+		default:
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return results
+	}
+
+	orders := make([]models.Order, len(pending))
+	for j, i := range pending {
+		orders[j] = rows[i].Order
+		orders[j].Status = models.OrderStatusCreated
+	}
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&orders).Error; err != nil {
+			return err
+		}
+		for j := range orders {
+			if err := enqueueOrderEvent(tx, events.OrderCreated, &orders[j]); err != nil {
+				return err
+			}
+			if err := audit.Record(tx, s.Audit, "import", "order", orders[j].ID, nil, &orders[j]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to import orders", "first_row", rows[pending[0]].Row, "error", err.Error())
+	}
+
+	for j, i := range pending {
+		if err != nil {
+			results[i].Status = models.ImportRowFailed
+			results[i].Error = "failed to create order"
+			continue
+		}
+		results[i].Status = models.ImportRowCreated
+		results[i].OrderID = orders[j].ID
+	}
+	return results
+}
+
+// verifyUsers checks the users of a chunk, retrying with a growing backoff when the check fails
+func (s *ImportService) verifyUsers(ctx context.Context, ids []uint) (map[uint]bool, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var exists map[uint]bool
+		exists, err = s.UserProjection.UsersExist(ctx, ids)
+		if err == nil || attempt >= importVerifyAttempts {
+			return exists, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(time.Duration(attempt) * importVerifyBackoff):
+		}
+	}
+}
+
+// StartImportJob stores a pending job and imports the file in the background, closing it when done.
+// The import keeps the request ID of ctx but outlives the request.
+func (s *ImportService) StartImportJob(ctx context.Context, file *ImportFile) (*models.ImportJob, error) {
+	job := models.ImportJob{
+		ID:          events.NewID(),
+		Status:      models.ImportJobPending,
+		Format:      file.Format,
+		Actor:       s.Audit.Actor,
+		Total:       file.Rows,
+		HeartbeatAt: time.Now(),
+	}
+	if err := s.DB.WithContext(ctx).Create(&job).Error; err != nil {
+		return nil, apierror.Wrap("failed to create import job", err)
+	}
+
+	go s.runImportJob(context.WithoutCancel(ctx), job, file)
+	return &job, nil
+}
+
+func (s *ImportService) runImportJob(ctx context.Context, job models.ImportJob, file *ImportFile) {
+	defer file.Close()
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go s.heartbeat(ctx, job.ID, stopHeartbeat)
+
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "import job panicked", "job_id", job.ID, "panic", fmt.Sprint(r))
+			now := time.Now()
+			job.Status = models.ImportJobFailed
+			job.Error = "import aborted"
+			job.FinishedAt = &now
+			s.DB.WithContext(ctx).Save(&job)
+		}
+	}()
+
+	job.Status = models.ImportJobRunning
+	job.HeartbeatAt = time.Now()
+	if err := s.DB.WithContext(ctx).Save(&job).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to start import job", "job_id", job.ID, "error", err.Error())
+	}
+
+	rows, err := file.Reader()
+	report := &models.ImportReport{}
+	if err == nil {
+		report, err = s.Import(ctx, rows)
+	}
+
+	now := time.Now()
+	job.Status = models.ImportJobCompleted
+	if err != nil {
+		slog.ErrorContext(ctx, "import job failed", "job_id", job.ID, "error", err.Error())
+		job.Status = models.ImportJobFailed
+		job.Error = "failed to read import file"
+	}
+	job.Created = report.Created
+	job.Failed = report.Failed
+	job.Results = report.Results
+	job.FinishedAt = &now
+	if err := s.DB.WithContext(ctx).Save(&job).Error; err != nil {
+		slog.ErrorContext(ctx, "failed to store import job report", "job_id", job.ID, "error", err.Error())
+	}
+}
+
+// heartbeat records that the job is alive every importJobHeartbeat until stop is closed
+func (s *ImportService) heartbeat(ctx context.Context, jobID string, stop <-chan struct{}) {
+	ticker := time.NewTicker(importJobHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.DB.WithContext(ctx).Model(&models.ImportJob{}).Where("id = ?", jobID).Update("heartbeat_at", time.Now()).Error; err != nil {
+				slog.ErrorContext(ctx, "failed to record import job heartbeat", "job_id", jobID, "error", err.Error())
+			}
+		}
+	}
+}
+
+func (s *ImportService) GetImportJob(ctx context.Context, id string) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := s.DB.WithContext(ctx).First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FailInterruptedJobs marks as failed the unfinished jobs whose heartbeat stopped, because the instance
+// running them stopped. Jobs of other instances keep their heartbeat and are left alone. Orders of chunks
+// committed before the interruption remain created.
+func (s *ImportService) FailInterruptedJobs(ctx context.Context) error {
+	return s.DB.WithContext(ctx).Model(&models.ImportJob{}).
+		Where("status IN ?", []string{models.ImportJobPending, models.ImportJobRunning}).
+		Where("heartbeat_at IS NULL OR heartbeat_at < ?", time.Now().Add(-3*importJobHeartbeat)).
+		Updates(map[string]interface{}{"status": models.ImportJobFailed, "error": "interrupted", "finished_at": time.Now()}).Error
+}
+
+// MonitorJobs runs FailInterruptedJobs every importJobHeartbeat until ctx is done
+func (s *ImportService) MonitorJobs(ctx context.Context) {
+	ticker := time.NewTicker(importJobHeartbeat)
+	defer ticker.Stop()
+	for {
+		if err := s.FailInterruptedJobs(ctx); err != nil {
+			slog.Error("failed to mark interrupted import jobs", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"order-api/models"
+	"order-api/utils"
+	"os"
+	"shared/audit"
+	"shared/database/databasetest"
+	"shared/outbox"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readImport(t *testing.T, file, format string) []ImportRow {
+	reader, err := NewImportReader(strings.NewReader(file), format)
+	require.NoError(t, err)
+	var rows []ImportRow
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestImportReaderCSV(t *testing.T) {
+	file := "item_description,user_id,item_quantity,item_price,total_value\n" +
+		"Notebook,1,2,10.5,21\n" +
+		"Pen,x,1,1,1\n" +
+		"Too,few\n"
+
+	rows := readImport(t, file, models.ImportFormatCSV)
+
+	assert.Len(t, rows, 3)
+	assert.NoError(t, rows[0].Err)
+	assert.Equal(t, models.Order{UserID: 1, ItemDescription: "Notebook", ItemQuantity: 2, ItemPrice: 10.5, TotalValue: 21}, rows[0].Order)
+	assert.EqualError(t, rows[1].Err, "user_id: invalid number")
+	assert.Equal(t, 3, rows[2].Row)
+	assert.Error(t, rows[2].Err)
+}
+
+func TestImportReaderCSVMissingColumn(t *testing.T) {
+	_, err := NewImportReader(strings.NewReader("user_id,item_description\n1,Pen\n"), models.ImportFormatCSV)
+
+	assert.EqualError(t, err, `missing CSV column "item_quantity"`)
+}
+
+func TestImportReaderNDJSON(t *testing.T) {
+	file := `{"user_id":1,"item_description":"Notebook","item_quantity":2,"item_price":10.5,"total_value":21}` + "\n\n" +
+		`{"user_id":` + "\n"
+
+	rows := readImport(t, file, models.ImportFormatNDJSON)
+
+	assert.Len(t, rows, 2)
+	assert.Equal(t, uint(1), rows[0].Order.UserID)
+	assert.Equal(t, 2, rows[1].Row)
+	assert.EqualError(t, rows[1].Err, "invalid JSON")
+}
+
+func TestSpoolImportCountsRowsAndRemovesFile(t *testing.T) {
+	file, err := SpoolImport(strings.NewReader("user_id,item_description,item_quantity,item_price,total_value\n1,Pen,1,1,1\n2,Pen,1,1,1\n"), models.ImportFormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, 2, file.Rows)
+
+	rows, err := file.Reader()
+	require.NoError(t, err)
+	row, err := rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), row.Order.UserID)
+
+	name := file.file.Name()
+	require.NoError(t, file.Close())
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSpoolImportRejectsUnreadableFile(t *testing.T) {
+	_, err := SpoolImport(strings.NewReader(`{"user_id":1}`+"\n"+strings.Repeat("x", 2<<20)), models.ImportFormatNDJSON)
+
+	assert.Error(t, err)
+}
+
+func TestImportReportsInvalidRows(t *testing.T) {
+	service := ImportService{ChunkSize: 10}
+	reader, err := NewImportReader(strings.NewReader("user_id,item_description,item_quantity,item_price,total_value\n1,Notebook,,,\nx,Pen,1,1,1\n"), models.ImportFormatCSV)
+	require.NoError(t, err)
+
+	report, err := service.Import(context.Background(), reader)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 0, report.Created)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, models.ImportRowInvalid, report.Results[0].Status)
+	assert.Contains(t, report.Results[0].Error, "item_quantity: invalid number")
+	assert.Equal(t, "user_id: invalid number", report.Results[1].Error)
+}
+
+// newImportTestService returns an import service on an in-memory database whose user check calls fetch
+func newImportTestService(t *testing.T, fetch func(userIDs []uint) (map[uint]models.User, error)) *ImportService {
+	db := databasetest.Open(t, &models.Order{}, &models.KnownUser{}, &models.ImportJob{}, &outbox.Event{}, &audit.Log{})
+
+	loader := utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return fetch(userIDs)
+	}, 0, 100)
+	projection := &UserProjectionService{DB: db, MaxAge: time.Hour, NegativeMaxAge: time.Minute, Loader: loader}
+	return &ImportService{DB: db, ChunkSize: 2, UserProjection: projection}
+}
+
+func TestImportRetriesUserVerification(t *testing.T) {
+	defer func(backoff time.Duration) { importVerifyBackoff = backoff }(importVerifyBackoff)
+	importVerifyBackoff = time.Millisecond
+
+	calls := 0
+	service := newImportTestService(t, func(userIDs []uint) (map[uint]models.User, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("user-api unavailable")
+		}
+		return map[uint]models.User{1: {ID: 1}}, nil
+	})
+	reader, err := NewImportReader(strings.NewReader("user_id,item_description,item_quantity,item_price,total_value\n1,Pen,1,1,1\n"), models.ImportFormatCSV)
+	require.NoError(t, err)
+
+	report, err := service.Import(context.Background(), reader)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, calls)
+}
+
+func TestImportFailsOnlyChunksWhoseUsersCannotBeVerified(t *testing.T) {
+	defer func(backoff time.Duration) { importVerifyBackoff = backoff }(importVerifyBackoff)
+	importVerifyBackoff = time.Millisecond
+
+	service := newImportTestService(t, func(userIDs []uint) (map[uint]models.User, error) {
+		users := make(map[uint]models.User)
+		for _, id := range userIDs {
+			if id == 3 {
+				return nil, errors.New("user-api unavailable")
+			}
+			users[id] = models.User{ID: id}
+		}
+		return users, nil
+	})
+	file := "user_id,item_description,item_quantity,item_price,total_value\n" +
+		"1,Pen,1,1,1\n2,Pen,1,1,1\n" +
+		"3,Pen,1,1,1\n1,Pen,1,1,1\n" +
+		"2,Pen,1,1,1\n"
+	reader, err := NewImportReader(strings.NewReader(file), models.ImportFormatCSV)
+	require.NoError(t, err)
+
+	report, err := service.Import(context.Background(), reader)
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, 3, report.Created)
+	statuses := make([]string, len(report.Results))
+	for i, result := range report.Results {
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []string{models.ImportRowCreated, models.ImportRowCreated, models.ImportRowFailed, models.ImportRowFailed, models.ImportRowCreated}, statuses)
+	assert.Equal(t, "failed to verify user ID", report.Results[2].Error)
+
+	var orders int64
+	service.DB.Model(&models.Order{}).Count(&orders)
+	assert.Equal(t, int64(3), orders)
+}
+
+func TestFailInterruptedJobsSkipsJobsWithAFreshHeartbeat(t *testing.T) {
+	service := newImportTestService(t, nil)
+	require.NoError(t, service.DB.Create(&[]models.ImportJob{
+		{ID: "alive", Status: models.ImportJobRunning, HeartbeatAt: time.Now()},
+		{ID: "stale", Status: models.ImportJobRunning, HeartbeatAt: time.Now().Add(-4 * importJobHeartbeat)},
+		{ID: "done", Status: models.ImportJobCompleted, HeartbeatAt: time.Now().Add(-4 * importJobHeartbeat)},
+	}).Error)
+
+	require.NoError(t, service.FailInterruptedJobs(context.Background()))
+
+	for id, status := range map[string]string{"alive": models.ImportJobRunning, "stale": models.ImportJobFailed, "done": models.ImportJobCompleted} {
+		job, err := service.GetImportJob(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, status, job.Status, id)
+	}
+}
@@ -1,85 +1,278 @@
 package services
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"order-api/metrics"
 	"order-api/models"
+	"order-api/search"
 	"order-api/utils"
-	"strings"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
+	"shared/config"
+	"shared/events"
+	"shared/export"
+	"shared/outbox"
+	"shared/validation"
+	"strconv"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 )
 
-var validate *validator.Validate
+var validate = validation.New()
 
-func init() {
-	validate = validator.New()
-}
+// ErrInvalidOrder is returned when an order is rejected by validation or by the order's state
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ErrUserVerification is returned when the user ID of an order could not be checked
+var ErrUserVerification = errors.New("user verification failed")
+
+// orderCacheTTL is how long GetOrderByID results stay cached
+var orderCacheTTL = config.GetEnvDuration("ORDER_CACHE_TTL", 5*time.Minute)
+
+// expandUserTimeout is how long ExpandUsers waits for the user-api before answering without users
+var expandUserTimeout = config.GetEnvDuration("EXPAND_USER_TIMEOUT", time.Second)
 
 type OrderService struct {
 	DB *gorm.DB
+	// Audit identifies the actor and request recorded in the audit log for write operations
+	Audit audit.Metadata
+	// Cache holds GetOrderByID results; writes invalidate the orders they change. Nil disables caching.
+	Cache cache.Cache
+	// Users looks up the users of ExpandUsers; nil uses utils.DefaultUserLoader
+	Users *utils.UserLoader
+	// UserProjection checks that the user of a new order exists; required by CreateOrder
+	UserProjection *UserProjectionService
 }
 
-func (s *OrderService) GetAllOrders() ([]models.Order, error) {
+// orderCacheKey returns the cache key of an order
+func orderCacheKey(id uint) string {
+	return fmt.Sprintf("order:%d", id)
+}
+
+func (s *OrderService) GetAllOrders(ctx context.Context) ([]models.Order, error) {
 	var orders []models.Order
-	if err := s.DB.Find(&orders).Error; err != nil {
+	if err := s.DB.WithContext(ctx).Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
-func (s *OrderService) GetOrderByID(id string) (*models.Order, error) {
-	var order models.Order
-	if err := s.DB.First(&order, id).Error; err != nil {
-		return nil, err
+func (s *OrderService) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	load := func(ctx context.Context) (*models.Order, error) {
+		var order models.Order
+		if err := s.DB.WithContext(ctx).First(&order, id).Error; err != nil {
+			return nil, err
+		}
+		return &order, nil
+	}
+
+	orderID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return load(ctx)
 	}
-	return &order, nil
+	return cache.GetOrLoad(ctx, s.Cache, orderCacheKey(uint(orderID)), orderCacheTTL, load)
 }
 
-func (s *OrderService) GetOrdersByUserID(userID int) ([]models.Order, error) {
+func (s *OrderService) GetOrdersByUserID(ctx context.Context, userID int) ([]models.Order, error) {
 	var orders []models.Order
-	if err := s.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+	if err := s.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
-func (s *OrderService) CreateOrder(order *models.Order) error {
-	exists, err := utils.CheckUserExists(order.UserID)
+// ExpandUsers embeds the user of each order, fetching all of them from the user-api in one batched
+// lookup. When the user-api fails or is too slow the orders are still returned, marked as partial.
+// Users are masked unless fullPII is true.
+func (s *OrderService) ExpandUsers(ctx context.Context, orders []models.Order, fullPII bool) []models.ExpandedOrder {
+	expanded := make([]models.ExpandedOrder, len(orders))
+	var userIDs []uint
+	for i := range orders {
+		expanded[i].Order = orders[i]
+		if orders[i].UserID != 0 {
+			userIDs = append(userIDs, orders[i].UserID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return expanded
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, expandUserTimeout)
+	defer cancel()
+	loader := s.Users
+	if loader == nil {
+		loader = utils.DefaultUserLoader
+	}
+	users, err := loader.LoadMany(ctx, userIDs)
 	if err != nil {
-		return errors.New("failed to verify user ID")
+		slog.WarnContext(ctx, "failed to expand order users", "error", err.Error())
+		metrics.UserExpansionFailures.Inc()
 	}
-	if !exists {
-		return errors.New("invalid user ID")
+	for i := range expanded {
+		if expanded[i].UserID == 0 {
+			continue
+		}
+		if err != nil {
+			expanded[i].Partial = true
+			continue
+		}
+		if user, ok := users[expanded[i].UserID]; ok {
+			if !fullPII {
+				user = user.Masked()
+			}
+			expanded[i].User = &user
+		}
 	}
+	return expanded
+}
 
-	if err := validate.Struct(order); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		errorMessages := make(map[string]string)
-		for _, err := range validationErrors {
-			errorMessages[err.Field()] = err.Tag()
+// OrderExportColumns are the columns an order export can select, in their default order
+var OrderExportColumns = []string{
+	"id", "user_id", "user_pseudonym", "item_description", "item_quantity", "item_price", "total_value",
+	"status", "created_at", "updated_at",
+}
+
+// orderExportValue returns the value of an order export column
+func orderExportValue(order *models.Order, column string) interface{} {
+	switch column {
+	case "id":
+		return order.ID
+	case "user_id":
+		return order.UserID
+	case "user_pseudonym":
+		return order.UserPseudonym
+	case "item_description":
+		return order.ItemDescription
+	case "item_quantity":
+		return order.ItemQuantity
+	case "item_price":
+		return order.ItemPrice
+	case "total_value":
+		return order.TotalValue
+	case "status":
+		return order.Status
+	case "created_at":
+		return order.CreatedAt
+	case "updated_at":
+		return order.UpdatedAt
+	default:
+		return nil
+	}
+}
+
+// ExportOrders writes the orders matching query to w in ID order. Rows are read one at a time from a
+// database cursor, so memory use does not grow with the number of orders.
+func (s *OrderService) ExportOrders(ctx context.Context, query models.OrderSearchQuery, columns []string, w export.Writer) error {
+	rows, err := s.DB.WithContext(ctx).Model(&models.Order{}).Scopes(search.FilterOrders(query)).
+		Select(columns).Order("id").Rows()
+	if err != nil {
+		return apierror.Wrap("failed to export orders", err)
+	}
+	defer rows.Close()
+
+	if err := w.WriteHeader(columns); err != nil {
+		return apierror.Wrap("failed to export orders", err)
+	}
+	values := make([]interface{}, len(columns))
+	for rows.Next() {
+		var order models.Order
+		if err := s.DB.ScanRows(rows, &order); err != nil {
+			return apierror.Wrap("failed to export orders", err)
 		}
-		var sb strings.Builder
-		for field, tag := range errorMessages {
-			sb.WriteString(fmt.Sprintf("%s: %s, ", field, tag))
+		for i, column := range columns {
+			values[i] = orderExportValue(&order, column)
 		}
-		errorMsg := strings.TrimRight(sb.String(), ", ")
-		return errors.New(errorMsg)
+		if err := w.WriteRow(values); err != nil {
+			return apierror.Wrap("failed to export orders", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return apierror.Wrap("failed to export orders", err)
+	}
+	return w.Close()
+}
+
+// FindOrders returns a page of the orders matching the filters of query, in ID order
+func (s *OrderService) FindOrders(ctx context.Context, query models.OrderSearchQuery) ([]models.Order, error) {
+	var orders []models.Order
+	err := s.DB.WithContext(ctx).Scopes(search.FilterOrders(query)).
+		Order("id").Limit(query.Limit).Offset(query.Offset).Find(&orders).Error
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch orders", err)
+	}
+	return orders, nil
+}
+
+// GetLatestOrdersByUserIDs returns up to limit of the most recent orders of each user in one query
+func (s *OrderService) GetLatestOrdersByUserIDs(ctx context.Context, userIDs []uint, limit int) (map[uint][]models.Order, error) {
+	ranked := s.DB.Model(&models.Order{}).
+		Select("orders.*, row_number() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS row_num").
+		Where("user_id IN ?", userIDs)
+	var orders []models.Order
+	err := s.DB.WithContext(ctx).Table("(?) AS ranked", ranked).
+		Where("row_num <= ?", limit).Order("user_id, row_num").Find(&orders).Error
+	if err != nil {
+		return nil, apierror.Wrap("failed to fetch orders", err)
+	}
+
+	result := make(map[uint][]models.Order, len(userIDs))
+	for _, order := range orders {
+		result[order.UserID] = append(result[order.UserID], order)
+	}
+	return result, nil
+}
+
+func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) error {
+	exists, err := s.UserProjection.UserExists(ctx, order.UserID)
+	if err != nil {
+		metrics.UserVerificationFailures.WithLabelValues("error").Inc()
+		return apierror.Wrap("failed to verify user ID", fmt.Errorf("%w: %w", ErrUserVerification, err))
+	}
+	if !exists {
+		metrics.UserVerificationFailures.WithLabelValues("not_found").Inc()
+		return apierror.Wrap("invalid user ID", ErrInvalidOrder)
 	}
 
-	if err := s.DB.Create(order).Error; err != nil {
-		return errors.New("failed to create order")
+	if err := validate.Struct(order); err != nil {
+		return apierror.Wrap(validation.Error(err).Error(), ErrInvalidOrder)
 	}
 
+	order.Status = models.OrderStatusCreated
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		if err := enqueueOrderEvent(tx, events.OrderCreated, order); err != nil {
+			return err
+		}
+		return audit.Record(tx, s.Audit, "create", "order", order.ID, nil, order)
+	})
+	if err != nil {
+		return apierror.Wrap("failed to create order", err)
+	}
+	metrics.OrdersCreated.Inc()
+
 	return nil
 }
 
-func (s *OrderService) UpdateOrder(id string, order *models.Order) (*models.Order, error) {
+func (s *OrderService) UpdateOrder(ctx context.Context, id string, order *models.Order) (*models.Order, error) {
+	db := s.DB.WithContext(ctx)
 	var existingOrder models.Order
-	if err := s.DB.First(&existingOrder, id).Error; err != nil {
-		return nil, errors.New("order not found")
+	if err := db.First(&existingOrder, id).Error; err != nil {
+		return nil, apierror.Wrap("order not found", err)
+	}
+	if existingOrder.Status == models.OrderStatusCancelled {
+		return nil, apierror.Wrap("order is cancelled", ErrInvalidOrder)
 	}
+	before := existingOrder
 
 	if order.UserID != 0 {
 		existingOrder.UserID = order.UserID
@@ -97,16 +290,136 @@ func (s *OrderService) UpdateOrder(id string, order *models.Order) (*models.Orde
 		existingOrder.TotalValue = order.TotalValue
 	}
 
-	if err := s.DB.Save(&existingOrder).Error; err != nil {
-		return nil, errors.New("failed to update order")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingOrder).Error; err != nil {
+			return err
+		}
+		if err := enqueueOrderEvent(tx, events.OrderUpdated, &existingOrder); err != nil {
+			return err
+		}
+		return audit.Record(tx, s.Audit, "update", "order", existingOrder.ID, &before, &existingOrder)
+	})
+	if err != nil {
+		return nil, apierror.Wrap("failed to update order", err)
 	}
+	cache.Invalidate(context.WithoutCancel(ctx), s.Cache, orderCacheKey(existingOrder.ID))
 
 	return &existingOrder, nil
 }
 
-func (s *OrderService) DeleteOrder(id string) error {
-	if err := s.DB.Delete(&models.Order{}, id).Error; err != nil {
-		return errors.New("order not found")
+func (s *OrderService) DeleteOrder(ctx context.Context, id string) error {
+	db := s.DB.WithContext(ctx)
+	var existingOrder models.Order
+	if err := db.First(&existingOrder, id).Error; err != nil {
+		return apierror.Wrap("order not found", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&existingOrder).Error; err != nil {
+			return err
+		}
+		if err := enqueueOrderEvent(tx, events.OrderDeleted, &existingOrder); err != nil {
+			return err
+		}
+		return audit.Record(tx, s.Audit, "delete", "order", existingOrder.ID, &existingOrder, nil)
+	})
+	if err != nil {
+		return apierror.Wrap("failed to delete order", err)
 	}
+	cache.Invalidate(context.WithoutCancel(ctx), s.Cache, orderCacheKey(existingOrder.ID))
 	return nil
 }
+
+// CancelOrder marks an order as cancelled; cancelled orders can no longer be updated
+func (s *OrderService) CancelOrder(ctx context.Context, id string) (*models.Order, error) {
+	db := s.DB.WithContext(ctx)
+	var existingOrder models.Order
+	if err := db.First(&existingOrder, id).Error; err != nil {
+		return nil, apierror.Wrap("order not found", err)
+	}
+	if existingOrder.Status == models.OrderStatusCancelled {
+		return nil, apierror.Wrap("order is already cancelled", ErrInvalidOrder)
+	}
+	before := existingOrder
+	existingOrder.Status = models.OrderStatusCancelled
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingOrder).Error; err != nil {
+			return err
+		}
+		if err := enqueueOrderEvent(tx, events.OrderCancelled, &existingOrder); err != nil {
+			return err
+		}
+		return audit.Record(tx, s.Audit, "cancel", "order", existingOrder.ID, &before, &existingOrder)
+	})
+	if err != nil {
+		return nil, apierror.Wrap("failed to cancel order", err)
+	}
+	cache.Invalidate(context.WithoutCancel(ctx), s.Cache, orderCacheKey(existingOrder.ID))
+	return &existingOrder, nil
+}
+
+var pseudonymKey []byte
+
+// InitPseudonymKey configures the HMAC key used to derive user pseudonyms. The key must stay secret:
+// user IDs are small integers, so pseudonyms made with a known key can be reversed by brute force.
+func InitPseudonymKey(key string) error {
+	if key == "" {
+		return errors.New("order pseudonym key is required")
+	}
+	pseudonymKey = []byte(key)
+	return nil
+}
+
+// enqueueOrderEvent writes a domain event about order into the outbox using tx,
+// so the event is stored if and only if the change is committed
+func enqueueOrderEvent(tx *gorm.DB, eventType string, order *models.Order) error {
+	return outbox.Enqueue(tx, eventType, "order", order.ID, order)
+}
+
+// PseudonymizeOrdersByUserID detaches a user's orders from the user ID, replacing it with a keyed
+// pseudonym so the orders and their financial totals can still be grouped without identifying the user
+func (s *OrderService) PseudonymizeOrdersByUserID(ctx context.Context, userID int) (int64, error) {
+	if pseudonymKey == nil {
+		return 0, errors.New("order pseudonymization is not configured")
+	}
+	db := s.DB.WithContext(ctx)
+	mac := hmac.New(sha256.New, pseudonymKey)
+	mac.Write([]byte(strconv.Itoa(userID)))
+	pseudonym := "anon-" + hex.EncodeToString(mac.Sum(nil))[:16]
+
+	var orders []models.Order
+	if err := db.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+		return 0, apierror.Wrap("failed to pseudonymize orders", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range orders {
+			before := orders[i]
+			orders[i].UserID = 0
+			orders[i].UserPseudonym = pseudonym
+			if err := tx.Model(&orders[i]).Updates(map[string]interface{}{"user_id": 0, "user_pseudonym": pseudonym}).Error; err != nil {
+				return err
+			}
+			if err := enqueueOrderEvent(tx, events.OrderUpdated, &orders[i]); err != nil {
+				return err
+			}
+			// only the field names, so the log does not link the pseudonym back to the user
+			if err := audit.RecordFields(tx, s.Audit, "pseudonymize", "order", orders[i].ID, &before, &orders[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, apierror.Wrap("failed to pseudonymize orders", err)
+	}
+	if len(orders) > 0 {
+		keys := make([]string, len(orders))
+		for i := range orders {
+			keys[i] = orderCacheKey(orders[i].ID)
+		}
+		cache.Invalidate(context.WithoutCancel(ctx), s.Cache, keys...)
+	}
+	return int64(len(orders)), nil
+}
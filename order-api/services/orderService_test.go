@@ -1,7 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"order-api/models"
+	"order-api/utils"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetAllOrders(t *testing.T) {
@@ -27,3 +34,69 @@ func TestUpdateOrder(t *testing.T) {
 func TestDeleteOrder(t *testing.T) {
 	// TODO: Write test cases for DeleteOrder function
 }
+
+func TestExpandUsers(t *testing.T) {
+	var requested [][]uint
+	service := OrderService{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		requested = append(requested, userIDs)
+		return map[uint]models.User{1: {ID: 1, Name: "Maria"}}, nil
+	}, time.Millisecond, 100)}
+	orders := []models.Order{{ID: 10, UserID: 1}, {ID: 11, UserID: 2}, {ID: 12, UserID: 1}, {ID: 13, UserPseudonym: "anon-1a2b"}}
+
+	expanded := service.ExpandUsers(context.Background(), orders, true)
+
+	assert.Equal(t, [][]uint{{1, 2}}, requested)
+	assert.Len(t, expanded, 4)
+	assert.Equal(t, "Maria", expanded[0].User.Name)
+	assert.Nil(t, expanded[1].User)
+	assert.Equal(t, "Maria", expanded[2].User.Name)
+	assert.Nil(t, expanded[3].User)
+	for _, order := range expanded {
+		assert.False(t, order.Partial)
+	}
+}
+
+func TestExpandUsersMasksPII(t *testing.T) {
+	service := OrderService{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return map[uint]models.User{1: {ID: 1, CPF: "12345678909", Email: "maria@example.com", PhoneNumber: "11912345678"}}, nil
+	}, time.Millisecond, 100)}
+	orders := []models.Order{{ID: 10, UserID: 1}}
+
+	masked := service.ExpandUsers(context.Background(), orders, false)[0].User
+	assert.Equal(t, "***.***.789-09", masked.CPF)
+	assert.Equal(t, "m***@example.com", masked.Email)
+	assert.Equal(t, "*******5678", masked.PhoneNumber)
+
+	full := service.ExpandUsers(context.Background(), orders, true)[0].User
+	assert.Equal(t, "12345678909", full.CPF)
+}
+
+func TestExpandUsersWhenUserAPIFails(t *testing.T) {
+	service := OrderService{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		return nil, errors.New("connection refused")
+	}, time.Millisecond, 100)}
+	orders := []models.Order{{ID: 10, UserID: 1}, {ID: 11, UserPseudonym: "anon-1a2b"}}
+
+	expanded := service.ExpandUsers(context.Background(), orders, true)
+
+	assert.Equal(t, uint(10), expanded[0].ID)
+	assert.Nil(t, expanded[0].User)
+	assert.True(t, expanded[0].Partial)
+	// pseudonymized orders have no user to fetch, so nothing is missing
+	assert.False(t, expanded[1].Partial)
+}
+
+func TestExpandUsersWhenUserAPITimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { expandUserTimeout = timeout }(expandUserTimeout)
+	expandUserTimeout = 10 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+	service := OrderService{Users: utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		<-release
+		return nil, nil
+	}, time.Millisecond, 100)}
+
+	expanded := service.ExpandUsers(context.Background(), []models.Order{{ID: 10, UserID: 1}}, true)
+
+	assert.True(t, expanded[0].Partial)
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"order-api/models"
+	"shared/apierror"
+
+	"gorm.io/gorm"
+)
+
+// reportAggregates are the aggregate columns of every report row
+const reportAggregates = "COUNT(*) AS order_count, COALESCE(SUM(total_value), 0) AS revenue, COALESCE(AVG(total_value), 0) AS average_ticket"
+
+type ReportService struct {
+	DB *gorm.DB
+}
+
+// OrderReport aggregates revenue, order count and average ticket in SQL. Cancelled orders are left out.
+// Periods are truncated in the database session time zone; users are ranked by revenue.
+func (s *ReportService) OrderReport(ctx context.Context, filter models.OrderReportFilter) (*models.OrderReport, error) {
+	report := &models.OrderReport{GroupBy: filter.GroupBy, From: filter.From, To: filter.To, Rows: []models.OrderReportRow{}}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Model(&models.Order{}).Where("status <> ?", models.OrderStatusCancelled)
+		if filter.From != nil {
+			db = db.Where("created_at >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			db = db.Where("created_at < ?", *filter.To)
+		}
+		return db
+	}
+	db := s.DB.WithContext(ctx)
+
+	switch filter.GroupBy {
+	case models.ReportGroupByDay, models.ReportGroupByWeek, models.ReportGroupByMonth:
+		err := db.Scopes(scope).
+			Select("date_trunc(?, created_at) AS period, "+reportAggregates, filter.GroupBy).
+			Group("period").Order("period").
+			Scan(&report.Rows).Error
+		if err != nil {
+			return nil, apierror.Wrap("failed to build report", err)
+		}
+	case models.ReportGroupByUser:
+		err := db.Scopes(scope).
+			Select("user_id, COALESCE(user_pseudonym, '') AS user_pseudonym, " + reportAggregates).
+			Group("user_id, COALESCE(user_pseudonym, '')").Order("revenue DESC, user_id").Limit(filter.Limit).
+			Scan(&report.Rows).Error
+		if err != nil {
+			return nil, apierror.Wrap("failed to build report", err)
+		}
+	default:
+		return nil, errors.New("invalid group_by")
+	}
+
+	if err := db.Scopes(scope).Select(reportAggregates).Scan(&report.Totals).Error; err != nil {
+		return nil, apierror.Wrap("failed to build report", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"order-api/models"
+	"order-api/search"
+	"shared/events"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SearchService struct {
+	DB    *gorm.DB
+	Index search.OrderIndex
+	// indexReady is set once EnsureIndex succeeds; until then every event tries to prepare the index
+	indexReady atomic.Bool
+}
+
+func (s *SearchService) SearchOrders(ctx context.Context, query models.OrderSearchQuery) (*models.OrderSearchResult, error) {
+	return s.Index.Search(ctx, query)
+}
+
+// HandleOrderEvent applies an order event to the index, versioned by the time of the change.
+// While the index cannot be prepared the event fails, so the broker delivers it again later.
+func (s *SearchService) HandleOrderEvent(ctx context.Context, event events.Event) error {
+	if !s.indexReady.Load() {
+		if err := s.Index.EnsureIndex(ctx); err != nil {
+			return err
+		}
+		s.indexReady.Store(true)
+	}
+
+	var order models.Order
+	if err := json.Unmarshal(event.Data, &order); err != nil {
+		return err
+	}
+	if event.Type == events.OrderDeleted {
+		return s.Index.Delete(ctx, order.ID, event.OccurredAt)
+	}
+	return s.Index.Index(ctx, []models.Order{order}, event.OccurredAt)
+}
+
+// Reindex copies every order into the index in batches and returns how many were indexed.
+// Each batch is versioned by the time just before it was read, so events of later changes still replace it.
+func (s *SearchService) Reindex(ctx context.Context, batchSize int) (int, error) {
+	if err := s.Index.EnsureIndex(ctx); err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	var lastID uint
+	for {
+		version := time.Now()
+		var orders []models.Order
+		if err := s.DB.WithContext(ctx).Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&orders).Error; err != nil {
+			return indexed, err
+		}
+		if len(orders) == 0 {
+			return indexed, nil
+		}
+		if err := s.Index.Index(ctx, orders, version); err != nil {
+			return indexed, err
+		}
+		indexed += len(orders)
+		lastID = orders[len(orders)-1].ID
+	}
+}
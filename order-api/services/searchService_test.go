@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"order-api/models"
+	"shared/events"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyIndex fails EnsureIndex until ready is set and records the indexed orders
+type flakyIndex struct {
+	ready   bool
+	ensures int
+	indexed []uint
+}
+
+func (i *flakyIndex) EnsureIndex(ctx context.Context) error {
+	i.ensures++
+	if !i.ready {
+		return errors.New("index unavailable")
+	}
+	return nil
+}
+
+func (i *flakyIndex) Index(ctx context.Context, orders []models.Order, version time.Time) error {
+	for _, order := range orders {
+		i.indexed = append(i.indexed, order.ID)
+	}
+	return nil
+}
+
+func (i *flakyIndex) Delete(ctx context.Context, id uint, version time.Time) error {
+	return nil
+}
+
+func (i *flakyIndex) Search(ctx context.Context, query models.OrderSearchQuery) (*models.OrderSearchResult, error) {
+	return &models.OrderSearchResult{}, nil
+}
+
+func TestHandleOrderEventWaitsForIndex(t *testing.T) {
+	index := &flakyIndex{}
+	service := SearchService{Index: index}
+	event := events.Event{Type: events.OrderCreated, Data: []byte(`{"id":1}`), OccurredAt: time.Now()}
+
+	assert.Error(t, service.HandleOrderEvent(context.Background(), event))
+	assert.Empty(t, index.indexed)
+
+	index.ready = true
+	assert.NoError(t, service.HandleOrderEvent(context.Background(), event))
+	assert.NoError(t, service.HandleOrderEvent(context.Background(), event))
+
+	assert.Equal(t, []uint{1, 1}, index.indexed)
+	assert.Equal(t, 2, index.ensures, "the index is prepared only until it succeeds")
+}
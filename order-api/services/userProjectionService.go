@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"order-api/models"
+	"order-api/utils"
+	"shared/events"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserProjectionService keeps the local projection of user-api users and answers user existence
+// checks from it, calling the user-api only for unknown users or stale entries
+type UserProjectionService struct {
+	DB *gorm.DB
+	// MaxAge is how long an entry is trusted without being confirmed again
+	MaxAge time.Duration
+	// NegativeMaxAge is how long an entry of a missing user is trusted, kept short so a user created
+	// just before its event reaches the projection is not rejected for long
+	NegativeMaxAge time.Duration
+	// Loader looks up users in the user-api; nil uses utils.DefaultUserLoader
+	Loader *utils.UserLoader
+}
+
+// HandleUserEvent applies a UserCreated, UserUpdated or UserDeleted event to the projection. Anonymized
+// users are projected as missing, so no new order is linked to an erased user.
+func (s *UserProjectionService) HandleUserEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.UserCreated, events.UserUpdated, events.UserDeleted:
+	default:
+		return nil
+	}
+
+	var data events.UserData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return err
+	}
+	exists := event.Type != events.UserDeleted && !data.Anonymized
+
+	return s.upsert(ctx, models.KnownUser{UserID: data.ID, Exists: exists, LastEventAt: event.OccurredAt, SyncedAt: time.Now()})
+}
+
+// UserExists reports whether the user exists and is not anonymized, trusting fresh projection entries
+func (s *UserProjectionService) UserExists(ctx context.Context, userID uint) (bool, error) {
+	result, err := s.UsersExist(ctx, []uint{userID})
+	if err != nil {
+		return false, err
+	}
+	return result[userID], nil
+}
+
+// UsersExist answers UserExists for many users at once: fresh projection entries are read in one
+// query and the remaining users are looked up in the user-api in batches shared with concurrent callers
+func (s *UserProjectionService) UsersExist(ctx context.Context, userIDs []uint) (map[uint]bool, error) {
+	var known []models.KnownUser
+	if err := s.DB.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&known).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]bool, len(userIDs))
+	lastEventAt := make(map[uint]time.Time)
+	for _, entry := range known {
+		maxAge := s.MaxAge
+		if !entry.Exists {
+			maxAge = s.NegativeMaxAge
+		}
+		if time.Since(entry.SyncedAt) < maxAge {
+			result[entry.UserID] = entry.Exists
+		} else {
+			lastEventAt[entry.UserID] = entry.LastEventAt
+		}
+	}
+	var missing []uint
+	for _, userID := range userIDs {
+		if _, ok := result[userID]; !ok {
+			missing = append(missing, userID)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	users, err := s.loader().LoadMany(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range missing {
+		user, found := users[userID]
+		exists := found && user.AnonymizedAt == nil
+		result[userID] = exists
+		// Keep the event timestamp so events older than this answer are still ignored
+		if err := s.upsert(ctx, models.KnownUser{UserID: userID, Exists: exists, LastEventAt: lastEventAt[userID], SyncedAt: time.Now()}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *UserProjectionService) loader() *utils.UserLoader {
+	if s.Loader != nil {
+		return s.Loader
+	}
+	return utils.DefaultUserLoader
+}
+
+// upsert stores the entry unless the projection already holds a newer event for the user
+func (s *UserProjectionService) upsert(ctx context.Context, known models.KnownUser) error {
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"exists", "last_event_at", "synced_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "known_users.last_event_at <= excluded.last_event_at"},
+		}},
+	}).Create(&known).Error
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"order-api/models"
+	"order-api/utils"
+	"shared/database/databasetest"
+	"shared/events"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProjectionTestService(t *testing.T, users map[uint]models.User) (*UserProjectionService, *int) {
+	db := databasetest.Open(t, &models.KnownUser{})
+
+	lookups := 0
+	loader := utils.NewUserLoader(func(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+		lookups++
+		found := make(map[uint]models.User)
+		for _, id := range userIDs {
+			if user, ok := users[id]; ok {
+				found[id] = user
+			}
+		}
+		return found, nil
+	}, 0, 100)
+	return &UserProjectionService{DB: db, MaxAge: time.Hour, NegativeMaxAge: time.Minute, Loader: loader}, &lookups
+}
+
+func TestUserExistsTrustsFreshEntries(t *testing.T) {
+	service, lookups := newProjectionTestService(t, map[uint]models.User{1: {ID: 1}})
+
+	for i := 0; i < 2; i++ {
+		exists, err := service.UserExists(context.Background(), 1)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+	assert.Equal(t, 1, *lookups)
+}
+
+func TestUserExistsRechecksMissingUsersSooner(t *testing.T) {
+	users := map[uint]models.User{}
+	service, lookups := newProjectionTestService(t, users)
+
+	exists, err := service.UserExists(context.Background(), 2)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = service.UserExists(context.Background(), 2)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, 1, *lookups)
+
+	// The user is created before its event reaches the projection
+	users[2] = models.User{ID: 2}
+	require.NoError(t, service.DB.Model(&models.KnownUser{}).Where("user_id = ?", 2).
+		Update("synced_at", time.Now().Add(-2*time.Minute)).Error)
+
+	exists, err = service.UserExists(context.Background(), 2)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 2, *lookups)
+}
+
+func TestUserExistsTreatsAnonymizedUsersAsMissing(t *testing.T) {
+	erasedAt := time.Now()
+	service, _ := newProjectionTestService(t, map[uint]models.User{3: {ID: 3, AnonymizedAt: &erasedAt}})
+
+	exists, err := service.UserExists(context.Background(), 3)
+	require.NoError(t, err)
+	assert.False(t, exists, "the user-api lookup returns the anonymized user")
+
+	data, err := json.Marshal(events.UserData{ID: 4, Anonymized: true})
+	require.NoError(t, err)
+	require.NoError(t, service.HandleUserEvent(context.Background(), events.Event{Type: events.UserUpdated, OccurredAt: time.Now(), Data: data}))
+	exists, err = service.UserExists(context.Background(), 4)
+	require.NoError(t, err)
+	assert.False(t, exists, "the erasure event removes the user from the projection")
+}
@@ -0,0 +1,393 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"order-api/models"
+	"shared/apierror"
+	"shared/config"
+	"shared/events"
+	"shared/validation"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// webhookAllowPrivateNetworks lets webhooks reach private, loopback and link-local addresses, for local development
+var webhookAllowPrivateNetworks = config.GetEnvBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false)
+
+// webhookClient traces outgoing deliveries; slow partners must not hold a delivery for long
+var webhookClient = newWebhookClient(webhookAllowPrivateNetworks)
+
+// ErrDeliveryInFlight is returned by Redeliver while a worker is sending the delivery
+var ErrDeliveryInFlight = errors.New("delivery is being sent")
+
+// webhookLease is how long a worker holds a delivery it is sending; an expired lease is taken again
+const webhookLease = time.Minute
+
+// errWebhookAddress is returned when a webhook URL points to an address partners must not reach
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// newWebhookClient returns a client that, unless allowPrivate is set, refuses to connect to non-public
+// addresses. The check runs on the resolved address of every connection, redirects included, so a
+// partner cannot reach internal services through DNS.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, host)
+			}
+			return nil
+		}
+	}
+	// No proxy, so the check sees the partner's own address
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Transport: otelhttp.NewTransport(transport), Timeout: 10 * time.Second}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+type WebhookService struct {
+	DB *gorm.DB
+	// MaxAttempts is the number of failed attempts after which a delivery goes to the dead-letter list
+	MaxAttempts int
+	// RetryBackoff is the wait after the first failure; it doubles on every attempt up to MaxBackoff
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the subscription secret, prefixed by "sha256="
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) CreateSubscription(ctx context.Context, request *models.WebhookRequest) (*models.WebhookSubscriptionCreated, error) {
+	if err := validate.Struct(request); err != nil {
+		return nil, validation.Error(err)
+	}
+	// Hostnames are checked on every delivery; literal addresses can be refused right away
+	if target, err := url.Parse(request.URL); err == nil && !webhookAllowPrivateNetworks {
+		if ip := net.ParseIP(target.Hostname()); ip != nil && !isPublicIP(ip) {
+			return nil, errors.New("URL: " + errWebhookAddress.Error())
+		}
+	}
+
+	secret := request.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, apierror.Wrap("failed to generate secret", err)
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	subscription := models.WebhookSubscription{URL: request.URL, EventTypes: request.EventTypes, Secret: secret, Active: true}
+	if err := s.DB.WithContext(ctx).Create(&subscription).Error; err != nil {
+		return nil, apierror.Wrap("failed to create webhook", err)
+	}
+	return &models.WebhookSubscriptionCreated{WebhookSubscription: subscription, Secret: secret}, nil
+}
+
+func (s *WebhookService) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	if err := s.DB.WithContext(ctx).Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (s *WebhookService) GetSubscriptionByID(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	if err := s.DB.WithContext(ctx).First(&subscription, id).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	result := s.DB.WithContext(ctx).Delete(&models.WebhookSubscription{}, id)
+	if result.Error != nil {
+		return apierror.Wrap("failed to delete webhook", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetDeliveries returns the delivery history of a subscription, newest first
+func (s *WebhookService) GetDeliveries(ctx context.Context, subscriptionID string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	if err := s.DB.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetDeadLetters returns the deliveries that exhausted their retries
+func (s *WebhookService) GetDeadLetters(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	if err := s.DB.WithContext(ctx).Where("status = ?", models.WebhookDeliveryDead).Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetDeliveryAttempts returns every attempt to send a delivery, oldest first
+func (s *WebhookService) GetDeliveryAttempts(ctx context.Context, deliveryID string) ([]models.WebhookDeliveryAttempt, error) {
+	db := s.DB.WithContext(ctx)
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, deliveryID).Error; err != nil {
+		return nil, err
+	}
+	var attempts []models.WebhookDeliveryAttempt
+	if err := db.Where("delivery_id = ?", delivery.ID).Order("id").Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// Redeliver schedules a delivery to be sent again right away with a fresh set of retries. Attempt
+// numbers keep growing so the history is kept whole. A delivery leased by a worker is left alone and
+// ErrDeliveryInFlight is returned.
+func (s *WebhookService) Redeliver(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	db := s.DB.WithContext(ctx)
+	result := db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status <> ?", id, models.WebhookDeliveryInFlight).
+		Updates(map[string]interface{}{
+			"status":                     models.WebhookDeliveryPending,
+			"attempts_before_redelivery": gorm.Expr("attempts"),
+			"next_attempt_at":            time.Now(),
+		})
+	if result.Error != nil {
+		return nil, apierror.Wrap("failed to schedule delivery", result.Error)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDeliveryInFlight
+	}
+	return &delivery, nil
+}
+
+// HandleOrderEvent creates one pending delivery per active subscription interested in the event.
+// Deliveries are unique per subscription and event, so events delivered twice are not sent twice.
+func (s *WebhookService) HandleOrderEvent(ctx context.Context, event events.Event) error {
+	var subscriptions []models.WebhookSubscription
+	if err := s.DB.WithContext(ctx).Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscribesTo(subscription, event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+func subscribesTo(subscription models.WebhookSubscription, eventType string) bool {
+	for _, t := range subscription.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Run sends due deliveries every interval until ctx is done
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DispatchDue(ctx, 20); err != nil {
+				slog.ErrorContext(ctx, "failed to dispatch webhooks", "error", err.Error())
+			}
+		}
+	}
+}
+
+// DispatchDue sends up to limit due deliveries. Each one is leased first by marking it in flight until
+// webhookLease from now, so other instances and Redeliver leave it alone while it is being sent.
+// Deliveries whose lease expired, because their worker stopped, are due again.
+func (s *WebhookService) DispatchDue(ctx context.Context, limit int) error {
+	var due []models.WebhookDelivery
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []string{models.WebhookDeliveryPending, models.WebhookDeliveryInFlight}, time.Now()).
+			Order("next_attempt_at").Limit(limit).Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(due))
+		for i := range due {
+			ids[i] = due[i].ID
+		}
+		lease := map[string]interface{}{"status": models.WebhookDeliveryInFlight, "next_attempt_at": time.Now().Add(webhookLease)}
+		if err := tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Updates(lease).Error; err != nil {
+			return err
+		}
+		for i := range due {
+			due[i].Status = models.WebhookDeliveryInFlight
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range due {
+		if err := s.deliver(ctx, &due[i]); err != nil {
+			slog.ErrorContext(ctx, "failed to record webhook delivery", "delivery_id", due[i].ID, "error", err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	var subscription models.WebhookSubscription
+	if err := s.DB.WithContext(ctx).First(&subscription, delivery.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.recordAttempt(ctx, delivery, 0, 0, errors.New("subscription deleted"), true)
+		}
+		return err
+	}
+
+	start := time.Now()
+	statusCode, err := s.send(ctx, subscription, delivery)
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("unexpected status code: %d", statusCode)
+	}
+	return s.recordAttempt(ctx, delivery, statusCode, time.Since(start), err, false)
+}
+
+func (s *WebhookService) send(ctx context.Context, subscription models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(subscription.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// recordAttempt stores the outcome of an attempt in the delivery's history, scheduling a retry with
+// exponential backoff or moving the delivery to the dead-letter list once MaxAttempts is reached
+func (s *WebhookService) recordAttempt(ctx context.Context, delivery *models.WebhookDelivery, statusCode int, duration time.Duration, err error, giveUp bool) error {
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	now := time.Now()
+	attempt := models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts,
+		StatusCode: statusCode,
+		DurationMs: duration.Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case giveUp || delivery.Attempts-delivery.AttemptsBeforeRedelivery >= s.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = models.WebhookDeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts - delivery.AttemptsBeforeRedelivery))
+	}
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(delivery).Error; err != nil {
+			return err
+		}
+		return tx.Create(&attempt).Error
+	})
+}
+
+// backoff returns RetryBackoff * 2^(attempts-1), capped at MaxBackoff
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	wait := s.RetryBackoff
+	for i := 1; i < attempts && wait < s.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.MaxBackoff {
+		wait = s.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"order-api/models"
+	"shared/database/databasetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+
+	signature := SignWebhookPayload("secret", "1700000000", body)
+
+	assert.Equal(t, "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54", signature)
+	assert.NotEqual(t, signature, SignWebhookPayload("other", "1700000000", body))
+	assert.NotEqual(t, signature, SignWebhookPayload("secret", "1700000001", body))
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	service := WebhookService{RetryBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+
+	assert.Equal(t, 10*time.Second, service.backoff(1))
+	assert.Equal(t, 20*time.Second, service.backoff(2))
+	assert.Equal(t, 40*time.Second, service.backoff(3))
+	assert.Equal(t, time.Minute, service.backoff(4))
+	assert.Equal(t, time.Minute, service.backoff(20))
+}
+
+func TestSubscribesTo(t *testing.T) {
+	subscription := models.WebhookSubscription{EventTypes: []string{"OrderCreated"}}
+
+	assert.True(t, subscribesTo(subscription, "OrderCreated"))
+	assert.False(t, subscribesTo(subscription, "OrderCancelled"))
+	assert.True(t, subscribesTo(models.WebhookSubscription{EventTypes: []string{"*"}}, "OrderCancelled"))
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := newWebhookClient(false).Post(server.URL, "application/json", nil)
+	assert.ErrorIs(t, err, errWebhookAddress)
+
+	resp, err := newWebhookClient(true).Post(server.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "fd00::1"} {
+		assert.False(t, isPublicIP(net.ParseIP(address)), address)
+	}
+	assert.True(t, isPublicIP(net.ParseIP("93.184.216.34")))
+	assert.True(t, isPublicIP(net.ParseIP("2606:2800:220:1::1")))
+}
+
+func TestCreateSubscriptionValidatesURL(t *testing.T) {
+	service := WebhookService{}
+	for _, url := range []string{"ftp://partner.example.com/hook", "file:///etc/passwd", "http://127.0.0.1:8080/hook", "http://[::1]/hook", "http://169.254.169.254/latest"} {
+		_, err := service.CreateSubscription(context.Background(), &models.WebhookRequest{URL: url, EventTypes: []string{"*"}})
+		assert.Error(t, err, url)
+	}
+}
+
+func TestRecordAttemptKeepsHistory(t *testing.T) {
+	db := databasetest.Open(t, &models.WebhookDelivery{}, &models.WebhookDeliveryAttempt{})
+	service := WebhookService{DB: db, MaxAttempts: 2, RetryBackoff: time.Second, MaxBackoff: time.Minute}
+	delivery := models.WebhookDelivery{SubscriptionID: 1, EventID: "event", Status: models.WebhookDeliveryPending, Payload: "{}"}
+	require.NoError(t, db.Create(&delivery).Error)
+
+	require.NoError(t, service.recordAttempt(context.Background(), &delivery, 500, 30*time.Millisecond, errors.New("unexpected status code: 500"), false))
+	require.NoError(t, service.recordAttempt(context.Background(), &delivery, 0, time.Second, errors.New("timeout"), false))
+
+	attempts, err := service.GetDeliveryAttempts(context.Background(), "1")
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, 1, attempts[0].Attempt)
+	assert.Equal(t, 500, attempts[0].StatusCode)
+	assert.Equal(t, int64(30), attempts[0].DurationMs)
+	assert.Equal(t, "unexpected status code: 500", attempts[0].Error)
+	assert.Equal(t, 2, attempts[1].Attempt)
+	assert.Equal(t, "timeout", attempts[1].Error)
+	assert.Equal(t, models.WebhookDeliveryDead, delivery.Status)
+
+	_, err = service.GetDeliveryAttempts(context.Background(), "2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestRedeliverKeepsAttemptNumbersAndSkipsLeasedDeliveries(t *testing.T) {
+	db := databasetest.Open(t, &models.WebhookDelivery{}, &models.WebhookDeliveryAttempt{})
+	service := WebhookService{DB: db, MaxAttempts: 2, RetryBackoff: time.Second, MaxBackoff: time.Minute}
+	delivery := models.WebhookDelivery{SubscriptionID: 1, EventID: "event", Status: models.WebhookDeliveryPending, Payload: "{}"}
+	require.NoError(t, db.Create(&delivery).Error)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, service.recordAttempt(context.Background(), &delivery, 500, 0, errors.New("unexpected status code: 500"), false))
+	}
+	require.Equal(t, models.WebhookDeliveryDead, delivery.Status)
+
+	redelivered, err := service.Redeliver(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, models.WebhookDeliveryPending, redelivered.Status)
+	assert.Equal(t, 2, redelivered.Attempts)
+
+	require.NoError(t, service.recordAttempt(context.Background(), redelivered, 500, 0, errors.New("unexpected status code: 500"), false))
+	assert.Equal(t, models.WebhookDeliveryPending, redelivered.Status, "the redelivery gets a fresh set of retries")
+	attempts, err := service.GetDeliveryAttempts(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts[2].Attempt)
+
+	require.NoError(t, db.Model(redelivered).Update("status", models.WebhookDeliveryInFlight).Error)
+	_, err = service.Redeliver(context.Background(), "1")
+	assert.ErrorIs(t, err, ErrDeliveryInFlight)
+	_, err = service.Redeliver(context.Background(), "2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -5,29 +5,38 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"order-api/metrics"
+	"order-api/models"
+	"strconv"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-type User struct {
-	ID uint `json:"id"`
-}
+// httpClient traces outgoing requests and propagates the W3C traceparent header
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
 
-func CheckUserExists(userID uint) (bool, error) {
-	url := fmt.Sprintf("http://user-service:8081/users/%d", userID)
+// CheckUserExists asks the user-api whether the user exists; anonymized users count as missing. The request ID and trace context
+// carried by ctx are forwarded to the user-api.
+func CheckUserExists(ctx context.Context, userID uint) (bool, error) {
+	url := fmt.Sprintf("%s/users/%d", UserAPIURL(), userID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := newUserAPIRequest(ctx, http.MethodGet, url)
 	if err != nil {
 		return false, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	resp, err := httpClient.Do(req)
 	if err != nil {
+		metrics.UserAPIRequestDuration.WithLabelValues("get_user", "error").Observe(time.Since(start).Seconds())
 		return false, err
 	}
 	defer resp.Body.Close()
+	metrics.UserAPIRequestDuration.WithLabelValues("get_user", strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
 
 	if resp.StatusCode == http.StatusNotFound {
 		return false, nil
@@ -37,11 +46,11 @@ func CheckUserExists(userID uint) (bool, error) {
 		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	var user User
+	var user models.User
 	err = json.NewDecoder(resp.Body).Decode(&user)
 	if err != nil {
 		return false, err
 	}
 
-	return user.ID == userID, nil
+	return user.ID == userID && user.AnonymizedAt == nil, nil
 }
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUserExistsTreatsAnonymizedUsersAsMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			w.Write([]byte(`{"id":1,"name":"John"}`))
+		case "/users/2":
+			w.Write([]byte(`{"id":2,"name":"Anonymized User","anonymized_at":"2024-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("USER_API_URL", server.URL)
+
+	for id, want := range map[uint]bool{1: true, 2: false, 3: false} {
+		exists, err := CheckUserExists(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, "user %d", id)
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loader coalesces concurrent lookups by key: the keys requested within a time window are
+// deduplicated and fetched with a single call, or earlier once a batch is full
+type Loader[K comparable, V any] struct {
+	fetch    func(ctx context.Context, keys []K) (map[K]V, error)
+	window   time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending *loaderBatch[K, V]
+}
+
+// loaderBatch is a set of keys fetched together; done is closed once values or err is set
+type loaderBatch[K comparable, V any] struct {
+	ctx    context.Context
+	keys   []K
+	seen   map[K]bool
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+// NewLoader returns a loader that waits up to window for more keys before calling fetch with at
+// most maxBatch keys
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error), window time.Duration, maxBatch int) *Loader[K, V] {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	return &Loader[K, V]{fetch: fetch, window: window, maxBatch: maxBatch}
+}
+
+// Load returns the value of key, or nil when fetch found none
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (*V, error) {
+	values, err := l.LoadMany(ctx, []K{key})
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := values[key]; ok {
+		return &value, nil
+	}
+	return nil, nil
+}
+
+// LoadMany returns the values of keys; keys fetch found nothing for are missing from the result.
+// The keys join the pending batch, which other callers may share.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	var batches []*loaderBatch[K, V]
+	l.mu.Lock()
+	for _, key := range keys {
+		batch := l.pending
+		if batch == nil {
+			batch = l.startBatch(ctx)
+		}
+		if !batch.seen[key] {
+			batch.seen[key] = true
+			batch.keys = append(batch.keys, key)
+		}
+		if len(batches) == 0 || batches[len(batches)-1] != batch {
+			batches = append(batches, batch)
+		}
+		if len(batch.keys) >= l.maxBatch {
+			l.pending = nil
+			go l.run(batch)
+		}
+	}
+	l.mu.Unlock()
+
+	result := make(map[K]V, len(keys))
+	for _, batch := range batches {
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		for _, key := range keys {
+			if value, ok := batch.values[key]; ok {
+				result[key] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// startBatch opens a new pending batch, sent when the window closes unless it fills up first.
+// The batch keeps the values of the first caller's context, such as the request ID, but not its
+// cancellation, since other callers depend on it. l.mu must be held.
+func (l *Loader[K, V]) startBatch(ctx context.Context) *loaderBatch[K, V] {
+	batch := &loaderBatch[K, V]{ctx: context.WithoutCancel(ctx), seen: make(map[K]bool), done: make(chan struct{})}
+	l.pending = batch
+	time.AfterFunc(l.window, func() {
+		l.mu.Lock()
+		if l.pending != batch {
+			l.mu.Unlock()
+			return
+		}
+		l.pending = nil
+		l.mu.Unlock()
+		l.run(batch)
+	})
+	return batch
+}
+
+func (l *Loader[K, V]) run(batch *loaderBatch[K, V]) {
+	batch.values, batch.err = l.fetch(batch.ctx, batch.keys)
+	close(batch.done)
+}
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"order-api/models"
 
 	"github.com/stretchr/testify/mock"
@@ -10,32 +11,42 @@ type OrderServiceMock struct {
 	mock.Mock
 }
 
-func (m *OrderServiceMock) GetAllOrders() ([]models.Order, error) {
-	args := m.Called()
+func (m *OrderServiceMock) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	args := m.Called(ctx)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
-func (m *OrderServiceMock) GetOrderByID(id string) (*models.Order, error) {
-	args := m.Called(id)
+func (m *OrderServiceMock) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	args := m.Called(ctx, id)
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *OrderServiceMock) GetOrdersByUserID(userID int) ([]models.Order, error) {
-	args := m.Called(userID)
+func (m *OrderServiceMock) GetOrdersByUserID(ctx context.Context, userID int) ([]models.Order, error) {
+	args := m.Called(ctx, userID)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
-func (m *OrderServiceMock) CreateOrder(order *models.Order) error {
-	args := m.Called(order)
+func (m *OrderServiceMock) CreateOrder(ctx context.Context, order *models.Order) error {
+	args := m.Called(ctx, order)
 	return args.Error(0)
 }
 
-func (m *OrderServiceMock) UpdateOrder(id string, order *models.Order) (*models.Order, error) {
-	args := m.Called(id, order)
+func (m *OrderServiceMock) UpdateOrder(ctx context.Context, id string, order *models.Order) (*models.Order, error) {
+	args := m.Called(ctx, id, order)
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *OrderServiceMock) DeleteOrder(id string) error {
-	args := m.Called(id)
+func (m *OrderServiceMock) CancelOrder(ctx context.Context, id string) (*models.Order, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *OrderServiceMock) DeleteOrder(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+func (m *OrderServiceMock) PseudonymizeOrdersByUserID(ctx context.Context, userID int) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
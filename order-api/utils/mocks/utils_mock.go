@@ -1,6 +1,9 @@
 package mocks
 
 import (
+	"context"
+	"order-api/models"
+
 	"github.com/stretchr/testify/mock"
 )
 
@@ -8,7 +11,18 @@ type UtilsMock struct {
 	mock.Mock
 }
 
-func (m *UtilsMock) CheckUserExists(userID int) (bool, error) {
-	args := m.Called(userID)
+func (m *UtilsMock) CheckUserExists(ctx context.Context, userID uint) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *UtilsMock) UserExists(ctx context.Context, userID uint) (bool, error) {
+	args := m.Called(ctx, userID)
 	return args.Bool(0), args.Error(1)
 }
+
+func (m *UtilsMock) GetUsers(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+	args := m.Called(ctx, userIDs)
+	users, _ := args.Get(0).(map[uint]models.User)
+	return users, args.Error(1)
+}
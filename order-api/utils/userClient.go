@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"order-api/metrics"
+	"order-api/models"
+	"shared/config"
+	"shared/logging"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserClient is how order-api reads users from the user-api
+type UserClient interface {
+	// UserExists reports whether the user exists and has not been anonymized
+	UserExists(ctx context.Context, userID uint) (bool, error)
+	// GetUsers fetches many users at once; users that do not exist are missing from the result
+	GetUsers(ctx context.Context, userIDs []uint) (map[uint]models.User, error)
+}
+
+// DefaultUserClient is the user-api client selected by USER_API_TRANSPORT
+var DefaultUserClient = NewUserClient()
+
+// NewUserClient returns the client selected by USER_API_TRANSPORT ("http" or "grpc")
+func NewUserClient() UserClient {
+	if config.GetEnv("USER_API_TRANSPORT", "http") == "grpc" {
+		client, err := NewGRPCUserClient(config.GetEnv("USER_API_GRPC_ADDR", "user-service:9081"))
+		if err != nil {
+			panic("failed to configure user-api gRPC client: " + err.Error())
+		}
+		return client
+	}
+	return HTTPUserClient{}
+}
+
+// HTTPUserClient calls the REST API of the user-api
+type HTTPUserClient struct{}
+
+func (HTTPUserClient) UserExists(ctx context.Context, userID uint) (bool, error) {
+	return CheckUserExists(ctx, userID)
+}
+
+func (HTTPUserClient) GetUsers(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+	return GetUsers(ctx, userIDs)
+}
+
+// UserAPIURL returns the base URL of the user-api
+func UserAPIURL() string {
+	return config.GetEnv("USER_API_URL", "http://user-service:8081")
+}
+
+// newUserAPIRequest builds a request to the user-api, authenticated with USER_API_KEY when set
+// and carrying the request ID of ctx as X-Request-ID
+func newUserAPIRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if apiKey := config.GetEnv("USER_API_KEY", ""); apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	return req, nil
+}
+
+// GetUsers fetches many users from the user-api in a single request. Users that do not exist are
+// missing from the result.
+func GetUsers(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	url := fmt.Sprintf("%s/users?ids=%s", UserAPIURL(), strings.Join(ids, ","))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := newUserAPIRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		metrics.UserAPIRequestDuration.WithLabelValues("get_users", "error").Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+	defer resp.Body.Close()
+	metrics.UserAPIRequestDuration.WithLabelValues("get_users", strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var users []models.User
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, err
+	}
+	result := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		result[user.ID] = user
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"order-api/metrics"
+	"order-api/models"
+	"shared/config"
+	"shared/logging"
+	"time"
+
+	userv1 "order-api/gen/user/v1"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCUserClient calls the gRPC UserService of the user-api
+type GRPCUserClient struct {
+	client userv1.UserServiceClient
+}
+
+// NewGRPCUserClient returns a client for the user-api gRPC server at addr. The connection is
+// established on the first call and re-established whenever it is lost.
+func NewGRPCUserClient(addr string) (*GRPCUserClient, error) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCUserClient{client: userv1.NewUserServiceClient(conn)}, nil
+}
+
+// outgoingContext bounds the call and attaches USER_API_KEY and the request ID of ctx as metadata
+func outgoingContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", requestID)
+	}
+	if apiKey := config.GetEnv("USER_API_KEY", ""); apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", apiKey)
+	}
+	return context.WithTimeout(ctx, 5*time.Second)
+}
+
+func (c *GRPCUserClient) UserExists(ctx context.Context, userID uint) (bool, error) {
+	ctx, cancel := outgoingContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := c.client.UserExists(ctx, &userv1.UserExistsRequest{Id: uint32(userID)})
+	metrics.UserAPIRequestDuration.WithLabelValues("user_exists", status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return false, err
+	}
+	return resp.Exists, nil
+}
+
+func (c *GRPCUserClient) GetUsers(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+	ids := make([]uint32, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = uint32(id)
+	}
+
+	ctx, cancel := outgoingContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := c.client.BatchGetUsers(ctx, &userv1.BatchGetUsersRequest{Ids: ids})
+	metrics.UserAPIRequestDuration.WithLabelValues("get_users", status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]models.User, len(resp.Users))
+	for _, user := range resp.Users {
+		result[uint(user.Id)] = userFromProto(user)
+	}
+	return result, nil
+}
+
+func userFromProto(user *userv1.User) models.User {
+	return models.User{
+		ID:           uint(user.Id),
+		Name:         user.Name,
+		CPF:          user.Cpf,
+		Email:        user.Email,
+		PhoneNumber:  user.PhoneNumber,
+		CreatedAt:    user.CreatedAt.AsTime(),
+		UpdatedAt:    optionalTime(user.UpdatedAt),
+		AnonymizedAt: optionalTime(user.AnonymizedAt),
+	}
+}
+
+// optionalTime converts a timestamp that may be unset
+func optionalTime(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := t.AsTime()
+	return &value
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"shared/logging"
+	"testing"
+	"time"
+
+	userv1 "order-api/gen/user/v1"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeUserServer knows user 1 and records the metadata of the last call
+type fakeUserServer struct {
+	userv1.UnimplementedUserServiceServer
+	md metadata.MD
+}
+
+func (s *fakeUserServer) UserExists(ctx context.Context, req *userv1.UserExistsRequest) (*userv1.UserExistsResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	return &userv1.UserExistsResponse{Exists: req.Id == 1}, nil
+}
+
+func (s *fakeUserServer) BatchGetUsers(ctx context.Context, req *userv1.BatchGetUsersRequest) (*userv1.BatchGetUsersResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &userv1.BatchGetUsersResponse{Users: []*userv1.User{
+		{Id: 1, Name: "Ana", Cpf: "***.***.***-01", CreatedAt: timestamppb.New(created)},
+	}}, nil
+}
+
+func newTestGRPCUserClient(t *testing.T, server userv1.UserServiceServer) *GRPCUserClient {
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	userv1.RegisterUserServiceServer(s, server)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///user-api",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &GRPCUserClient{client: userv1.NewUserServiceClient(conn)}
+}
+
+func TestGRPCUserClientUserExists(t *testing.T) {
+	t.Setenv("USER_API_KEY", "secret")
+	server := &fakeUserServer{}
+	client := newTestGRPCUserClient(t, server)
+	ctx := logging.ContextWithRequestID(context.Background(), "req-1")
+
+	exists, err := client.UserExists(ctx, 1)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []string{"secret"}, server.md.Get("x-api-key"))
+	assert.Equal(t, []string{"req-1"}, server.md.Get("x-request-id"))
+
+	exists, err = client.UserExists(ctx, 2)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestGRPCUserClientGetUsers(t *testing.T) {
+	client := newTestGRPCUserClient(t, &fakeUserServer{})
+
+	users, err := client.GetUsers(context.Background(), []uint{1, 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "Ana", users[1].Name)
+	assert.Equal(t, "***.***.***-01", users[1].CPF)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), users[1].CreatedAt)
+	assert.Nil(t, users[1].UpdatedAt)
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"order-api/models"
+	"shared/config"
+	"time"
+)
+
+// DefaultUserLoader batches the user lookups of the whole process through DefaultUserClient
+var DefaultUserLoader = NewUserLoader(DefaultUserClient.GetUsers,
+	config.GetEnvDuration("USER_LOOKUP_WINDOW", 5*time.Millisecond), lookupMaxBatch())
+
+// lookupMaxBatch returns USER_LOOKUP_MAX_BATCH, which defaults to and may not exceed USER_LOOKUP_MAX_IDS,
+// the number of IDs the user-api accepts per lookup; a larger batch would be rejected as a whole
+func lookupMaxBatch() int {
+	maxIDs := config.GetEnvInt("USER_LOOKUP_MAX_IDS", 100)
+	maxBatch := config.GetEnvInt("USER_LOOKUP_MAX_BATCH", maxIDs)
+	if maxBatch > maxIDs {
+		slog.Warn("USER_LOOKUP_MAX_BATCH exceeds USER_LOOKUP_MAX_IDS, using the smaller", "max_batch", maxBatch, "max_ids", maxIDs)
+		return maxIDs
+	}
+	return maxBatch
+}
+
+// UserLoader coalesces concurrent user lookups in the user-api
+type UserLoader = Loader[uint, models.User]
+
+// NewUserLoader returns a loader that waits up to window for more user IDs before calling fetch with
+// at most maxBatch IDs
+func NewUserLoader(fetch func(ctx context.Context, userIDs []uint) (map[uint]models.User, error), window time.Duration, maxBatch int) *UserLoader {
+	return NewLoader(fetch, window, maxBatch)
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"order-api/models"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingFetch returns users for every even ID and records the IDs of each call
+type recordingFetch struct {
+	mu    sync.Mutex
+	calls [][]uint
+	err   error
+}
+
+func (f *recordingFetch) fetch(ctx context.Context, userIDs []uint) (map[uint]models.User, error) {
+	f.mu.Lock()
+	ids := append([]uint(nil), userIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	f.calls = append(f.calls, ids)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	users := make(map[uint]models.User)
+	for _, id := range userIDs {
+		if id%2 == 0 {
+			users[id] = models.User{ID: id}
+		}
+	}
+	return users, nil
+}
+
+func TestUserLoaderCoalescesConcurrentLookups(t *testing.T) {
+	f := &recordingFetch{}
+	loader := NewUserLoader(f.fetch, 200*time.Millisecond, 100)
+
+	var wg sync.WaitGroup
+	results := make([]*models.User, 6)
+	for i, id := range []uint{2, 4, 2, 3, 4, 6} {
+		wg.Add(1)
+		go func(i int, id uint) {
+			defer wg.Done()
+			user, err := loader.Load(context.Background(), id)
+			assert.NoError(t, err)
+			results[i] = user
+		}(i, id)
+	}
+	wg.Wait()
+
+	assert.Equal(t, [][]uint{{2, 3, 4, 6}}, f.calls)
+	assert.Equal(t, uint(2), results[0].ID)
+	assert.Equal(t, uint(2), results[2].ID)
+	assert.Nil(t, results[3])
+	assert.Equal(t, uint(6), results[5].ID)
+}
+
+func TestUserLoaderSplitsFullBatches(t *testing.T) {
+	f := &recordingFetch{}
+	loader := NewUserLoader(f.fetch, 50*time.Millisecond, 2)
+
+	users, err := loader.LoadMany(context.Background(), []uint{2, 4, 6})
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	// the first batch is sent as soon as it is full, the second when the window closes
+	assert.Equal(t, [][]uint{{2, 4}, {6}}, f.calls)
+}
+
+func TestUserLoaderReturnsFetchErrorToEveryCaller(t *testing.T) {
+	f := &recordingFetch{err: errors.New("user-api unavailable")}
+	loader := NewUserLoader(f.fetch, 100*time.Millisecond, 100)
+
+	var wg sync.WaitGroup
+	for _, id := range []uint{1, 2} {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			_, err := loader.Load(context.Background(), id)
+			assert.EqualError(t, err, "user-api unavailable")
+		}(id)
+	}
+	wg.Wait()
+	assert.Len(t, f.calls, 1)
+}
+
+func TestUserLoaderStopsWaitingWhenContextEnds(t *testing.T) {
+	f := &recordingFetch{}
+	loader := NewUserLoader(f.fetch, time.Hour, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := loader.Load(ctx, 2)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLookupMaxBatchIsClampedToTheUserAPILimit(t *testing.T) {
+	t.Setenv("USER_LOOKUP_MAX_IDS", "50")
+	assert.Equal(t, 50, lookupMaxBatch())
+
+	t.Setenv("USER_LOOKUP_MAX_BATCH", "20")
+	assert.Equal(t, 20, lookupMaxBatch())
+
+	t.Setenv("USER_LOOKUP_MAX_BATCH", "500")
+	assert.Equal(t, 50, lookupMaxBatch())
+}
@@ -0,0 +1,41 @@
+package apierror
+
+import "errors"
+
+// ErrorResponse define a estrutura para respostas de erro
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// wrappedError keeps a client-facing message while preserving the underlying cause for logging
+type wrappedError struct {
+	message string
+	cause   error
+}
+
+func (e *wrappedError) Error() string {
+	return e.message
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.cause
+}
+
+// Wrap returns an error whose message is message and whose cause is cause
+func Wrap(message string, cause error) error {
+	if cause == nil {
+		return errors.New(message)
+	}
+	return &wrappedError{message: message, cause: cause}
+}
+
+// RootCause returns the innermost error wrapped by err
+func RootCause(err error) error {
+	for {
+		cause := errors.Unwrap(err)
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+}
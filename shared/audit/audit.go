@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// ignoredFields are bookkeeping fields left out of audit diffs
+var ignoredFields = map[string]bool{"created_at": true, "updated_at": true}
+
+const appendOnlySQL = `
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+CREATE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs
+	FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+`
+
+type Service struct {
+	DB *gorm.DB
+}
+
+// Migrate creates the audit table and the trigger that rejects updates and deletes on it
+func (s *Service) Migrate() error {
+	if err := s.DB.AutoMigrate(&Log{}); err != nil {
+		return err
+	}
+	return s.DB.Exec(appendOnlySQL).Error
+}
+
+func (s *Service) GetLogs(ctx context.Context, filter Filter) ([]Log, error) {
+	query := s.DB.WithContext(ctx).Order("created_at DESC, id DESC")
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var logs []Log
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// Record appends an audit entry using tx, so it is committed together with the change it describes
+func Record(tx *gorm.DB, meta Metadata, action, entity string, entityID uint, before, after interface{}) error {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	return record(tx, meta, action, entity, entityID, changes)
+}
+
+// RecordFields appends an audit entry like Record, keeping only the names of the changed fields. The
+// log is append-only, so entities holding personal data are audited this way: an erasure then leaves
+// nothing behind in the log to scrub.
+func RecordFields(tx *gorm.DB, meta Metadata, action, entity string, entityID uint, before, after interface{}) error {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	for field := range changes {
+		changes[field] = Change{Redacted: true}
+	}
+	return record(tx, meta, action, entity, entityID, changes)
+}
+
+func record(tx *gorm.DB, meta Metadata, action, entity string, entityID uint, changes map[string]Change) error {
+	actor := meta.Actor
+	if actor == "" {
+		actor = "anonymous"
+	}
+	entry := Log{
+		Actor:     actor,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  fmt.Sprint(entityID),
+		Changes:   changes,
+		RequestID: meta.RequestID,
+	}
+	return tx.Create(&entry).Error
+}
+
+// Diff compares the JSON representation of two values and returns the fields that differ.
+// A nil before or after describes a creation or a deletion.
+func Diff(before, after interface{}) (map[string]Change, error) {
+	beforeFields, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for field, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[field]) {
+			changes[field] = Change{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes[field] = Change{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func fields(value interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if value == nil {
+		return fields, nil
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return fields, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for field := range ignoredFields {
+		delete(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"shared/database/databasetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	ID          uint      `json:"id"`
+	Description string    `json:"description"`
+	Quantity    int       `json:"quantity"`
+	Total       float64   `json:"total"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func TestDiffCreate(t *testing.T) {
+	changes, err := Diff(nil, &item{ID: 1, Description: "Item", Quantity: 1, Total: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Change{After: "Item"}, changes["description"])
+	assert.NotContains(t, changes, "created_at")
+}
+
+func TestDiffUpdate(t *testing.T) {
+	before := &item{ID: 1, Description: "Item", Quantity: 1, Total: 10}
+	after := &item{ID: 1, Description: "Item", Quantity: 3, Total: 30, CreatedAt: time.Now()}
+
+	changes, err := Diff(before, after)
+
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, Change{Before: float64(1), After: float64(3)}, changes["quantity"])
+	assert.Equal(t, Change{Before: float64(10), After: float64(30)}, changes["total"])
+}
+
+func TestDiffDelete(t *testing.T) {
+	var missing *item
+
+	changes, err := Diff(&item{ID: 1, Description: "Item"}, missing)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Change{Before: "Item"}, changes["description"])
+}
+
+func TestRecordFieldsKeepsOnlyFieldNames(t *testing.T) {
+	db := databasetest.Open(t, &Log{})
+
+	before := &item{ID: 1, Description: "John's item", Quantity: 1}
+	after := &item{ID: 1, Description: "Jane's item", Quantity: 1}
+	require.NoError(t, RecordFields(db, Metadata{Actor: "ops"}, "update", "item", 1, before, after))
+
+	var entry Log
+	require.NoError(t, db.First(&entry).Error)
+	assert.Equal(t, map[string]Change{"description": {Redacted: true}}, entry.Changes)
+	assert.Equal(t, "1", entry.EntityID)
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"net/http"
+	"shared/apierror"
+	"shared/middleware"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequestMetadata identifies the caller and request of a write operation
+func RequestMetadata(c *gin.Context) Metadata {
+	return Metadata{
+		Actor:     middleware.GetPrincipal(c).Name,
+		RequestID: middleware.GetRequestID(c),
+	}
+}
+
+// Handler serves the audit log query: entity, entity_id and actor filter the entries and limit
+// (default 100) and offset page through them. Callers need a role in AUDIT_AUTHORIZED_ROLES.
+func Handler(db *gorm.DB) gin.HandlerFunc {
+	service := Service{DB: db}
+	return func(c *gin.Context) {
+		if !middleware.CanViewAudit(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid limit"})
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid offset"})
+			return
+		}
+
+		logs, err := service.GetLogs(c.Request.Context(), Filter{
+			Entity:   c.Query("entity"),
+			EntityID: c.Query("entity_id"),
+			Actor:    c.Query("actor"),
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to fetch audit logs"})
+			return
+		}
+		c.JSON(http.StatusOK, logs)
+	}
+}
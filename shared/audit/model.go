@@ -0,0 +1,42 @@
+package audit
+
+import "time"
+
+// Log records a write operation; the table is append-only
+type Log struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	Actor     string            `json:"actor" gorm:"index"`
+	Action    string            `json:"action"`
+	Entity    string            `json:"entity" gorm:"index:idx_audit_logs_entity"`
+	EntityID  string            `json:"entity_id" gorm:"index:idx_audit_logs_entity"`
+	Changes   map[string]Change `json:"changes" gorm:"type:jsonb;serializer:json"`
+	RequestID string            `json:"request_id,omitempty"`
+	CreatedAt time.Time         `json:"created_at" gorm:"index"`
+}
+
+func (Log) TableName() string {
+	return "audit_logs"
+}
+
+// Change holds the value of a field before and after an operation. Redacted changes only record that
+// the field changed, without its values.
+type Change struct {
+	Before   interface{} `json:"before"`
+	After    interface{} `json:"after"`
+	Redacted bool        `json:"redacted,omitempty"`
+}
+
+// Metadata identifies who performed an operation and in which request
+type Metadata struct {
+	Actor     string
+	RequestID string
+}
+
+// Filter holds the criteria of an audit log query
+type Filter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	Limit    int
+	Offset   int
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+	"shared/config"
+	"shared/metrics"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrMiss is returned by Get when the key is not cached
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores serialized values for a limited time
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// loads coalesces concurrent misses of the same key into a single load
+var loads singleflight.Group
+
+// invalidations counts Invalidate calls per key stripe, so a load that overlapped an invalidation of
+// its key does not cache what it read
+var invalidations [256]atomic.Uint64
+
+func invalidationCounter(key string) *atomic.Uint64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return &invalidations[hash.Sum32()%uint32(len(invalidations))]
+}
+
+// redeleteDelay is how long after an invalidation the keys are deleted again, to drop values cached
+// by loads on other instances that read the database before the write committed
+var redeleteDelay = time.Second
+
+// loadTimeout bounds a shared load, which no longer follows the context of the caller that started it
+var loadTimeout = config.GetEnvDuration("CACHE_LOAD_TIMEOUT", 10*time.Second)
+
+// GetOrLoad returns the cached value of key. On a miss it calls load and caches the result for about ttl;
+// concurrent misses of the same key share one load so an expired hot key does not stampede the database.
+// The shared load runs detached from the caller that started it, bounded by loadTimeout, so that caller
+// going away does not fail the others; each caller still returns as soon as its own ctx is done.
+// Cache failures are logged and fall back to load. A nil cache always calls load.
+func GetOrLoad[T any](ctx context.Context, c Cache, key string, ttl time.Duration, load func(ctx context.Context) (*T, error)) (*T, error) {
+	if c == nil {
+		return load(ctx)
+	}
+
+	data, err := c.Get(ctx, key)
+	if err == nil {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			metrics.CacheRequests.WithLabelValues("hit").Inc()
+			return &value, nil
+		}
+	} else if !errors.Is(err, ErrMiss) {
+		slog.WarnContext(ctx, "cache read failed", "key", key, "error", err.Error())
+	}
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+
+	// every caller decodes its own copy so callers never share a value
+	results := loads.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		generation := invalidationCounter(key).Load()
+		value, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if invalidationCounter(key).Load() != generation {
+			// The value may predate a write that was invalidated during the load
+			return data, nil
+		}
+		if err := c.Set(loadCtx, key, data, jitter(ttl)); err != nil {
+			slog.WarnContext(loadCtx, "cache write failed", "key", key, "error", err.Error())
+		}
+		return data, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	var value T
+	if err := json.Unmarshal(result.Val.([]byte), &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// Invalidate removes keys from the cache, logging failures; the entries still expire with their TTL.
+// Loads in progress in this process do not cache their result, new misses start a fresh load, and the
+// keys are deleted again after redeleteDelay to drop stale values cached by loads on other instances.
+func Invalidate(ctx context.Context, c Cache, keys ...string) {
+	if c == nil {
+		return
+	}
+	for _, key := range keys {
+		invalidationCounter(key).Add(1)
+		loads.Forget(key)
+	}
+	if err := c.Delete(ctx, keys...); err != nil {
+		slog.WarnContext(ctx, "cache invalidation failed", "keys", keys, "error", err.Error())
+	}
+	time.AfterFunc(redeleteDelay, func() {
+		if err := c.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+			slog.WarnContext(ctx, "cache invalidation failed", "keys", keys, "error", err.Error())
+		}
+	})
+}
+
+// jitter adds up to 10% to ttl so keys cached together do not all expire together
+func jitter(ttl time.Duration) time.Duration {
+	if ttl < 10 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(int64(ttl/10)))
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewMemoryCache()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	value, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	now = now.Add(time.Minute + time.Second)
+	_, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestMemoryCacheDelete(t *testing.T) {
+	c := NewMemoryCache()
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+
+	assert.NoError(t, c.Delete(ctx, "a", "missing"))
+
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestGetOrLoadCachesResult(t *testing.T) {
+	c := NewMemoryCache()
+	calls := 0
+	load := func(ctx context.Context) (*item, error) {
+		calls++
+		return &item{Name: "order"}, nil
+	}
+
+	first, err := GetOrLoad(context.Background(), c, "item:1", time.Minute, load)
+	assert.NoError(t, err)
+	second, err := GetOrLoad(context.Background(), c, "item:1", time.Minute, load)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "order", second.Name)
+	assert.NotSame(t, first, second)
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	c := NewMemoryCache()
+	calls := 0
+	load := func(ctx context.Context) (*item, error) {
+		calls++
+		return nil, errors.New("not found")
+	}
+
+	_, err := GetOrLoad(context.Background(), c, "item:1", time.Minute, load)
+	assert.Error(t, err)
+	_, err = GetOrLoad(context.Background(), c, "item:1", time.Minute, load)
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetOrLoadCoalescesConcurrentMisses(t *testing.T) {
+	c := NewMemoryCache()
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*item, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &item{Name: "order"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := GetOrLoad(context.Background(), c, "item:hot", time.Minute, load)
+			assert.NoError(t, err)
+			assert.Equal(t, "order", value.Name)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetOrLoadWithoutCache(t *testing.T) {
+	calls := 0
+	load := func(ctx context.Context) (*item, error) {
+		calls++
+		return &item{Name: "order"}, nil
+	}
+
+	GetOrLoad(context.Background(), nil, "item:1", time.Minute, load)
+	GetOrLoad(context.Background(), nil, "item:1", time.Minute, load)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetOrLoadSkipsWriteWhenInvalidatedDuringLoad(t *testing.T) {
+	c := NewMemoryCache()
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	stale := func(ctx context.Context) (*item, error) {
+		close(loading)
+		<-release
+		return &item{Name: "before"}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, err := GetOrLoad(context.Background(), c, "item:1", time.Minute, stale)
+		assert.NoError(t, err)
+		assert.Equal(t, "before", value.Name)
+	}()
+	<-loading
+	Invalidate(context.Background(), c, "item:1")
+	close(release)
+	<-done
+
+	_, err := c.Get(context.Background(), "item:1")
+	assert.ErrorIs(t, err, ErrMiss)
+
+	value, err := GetOrLoad(context.Background(), c, "item:1", time.Minute, func(ctx context.Context) (*item, error) {
+		return &item{Name: "after"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "after", value.Name)
+}
+
+func TestInvalidateDeletesAgainAfterDelay(t *testing.T) {
+	defer func(delay time.Duration) { redeleteDelay = delay }(redeleteDelay)
+	redeleteDelay = 10 * time.Millisecond
+	c := NewMemoryCache()
+
+	Invalidate(context.Background(), c, "item:1")
+	// A load on another instance caches the value it read before the write
+	c.Set(context.Background(), "item:1", []byte(`{"name":"before"}`), time.Minute)
+
+	assert.Eventually(t, func() bool {
+		_, err := c.Get(context.Background(), "item:1")
+		return errors.Is(err, ErrMiss)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestGetOrLoadSharedLoadOutlivesTheCallerThatStartedIt(t *testing.T) {
+	c := NewMemoryCache()
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*item, error) {
+		close(loading)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return &item{Name: "order"}, nil
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error)
+	go func() {
+		_, err := GetOrLoad(first, c, "item:shared", time.Minute, load)
+		firstDone <- err
+	}()
+	<-loading
+
+	secondDone := make(chan *item)
+	go func() {
+		value, err := GetOrLoad(context.Background(), c, "item:shared", time.Minute, load)
+		assert.NoError(t, err)
+		secondDone <- value
+	}()
+
+	cancel()
+	assert.ErrorIs(t, <-firstDone, context.Canceled, "the cancelled caller returns without waiting for the load")
+	close(release)
+	assert.Equal(t, "order", (<-secondDone).Name)
+}
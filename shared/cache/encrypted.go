@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// EncryptedCache encrypts values before storing them in the underlying cache, so cached values
+// never leave the process in plain text
+type EncryptedCache struct {
+	cache   Cache
+	encrypt func(plain string) (string, error)
+	decrypt func(value string) (string, error)
+}
+
+func NewEncryptedCache(cache Cache, encrypt, decrypt func(string) (string, error)) *EncryptedCache {
+	return &EncryptedCache{cache: cache, encrypt: encrypt, decrypt: decrypt}
+}
+
+func (c *EncryptedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := c.decrypt(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plain), nil
+}
+
+func (c *EncryptedCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	encrypted, err := c.encrypt(string(value))
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(ctx, key, []byte(encrypted), ttl)
+}
+
+func (c *EncryptedCache) Delete(ctx context.Context, keys ...string) error {
+	return c.cache.Delete(ctx, keys...)
+}
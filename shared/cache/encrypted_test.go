@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reverse(value string) (string, error) {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes), nil
+}
+
+func newTestEncryptedCache() (*EncryptedCache, *MemoryCache) {
+	memory := NewMemoryCache()
+	encrypt := func(plain string) (string, error) {
+		encrypted, _ := reverse(plain)
+		return "enc:" + encrypted, nil
+	}
+	decrypt := func(value string) (string, error) {
+		if !strings.HasPrefix(value, "enc:") {
+			return "", errors.New("not encrypted")
+		}
+		return reverse(strings.TrimPrefix(value, "enc:"))
+	}
+	return NewEncryptedCache(memory, encrypt, decrypt), memory
+}
+
+func TestEncryptedCacheStoresEncryptedValues(t *testing.T) {
+	c, memory := newTestEncryptedCache()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "user:1", []byte(`{"cpf":"12345678909"}`), time.Minute))
+
+	stored, err := memory.Get(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, `enc:}"90987654321":"fpc"{`, string(stored))
+
+	value, err := c.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cpf":"12345678909"}`, string(value))
+}
+
+func TestEncryptedCacheRejectsUndecryptableValues(t *testing.T) {
+	c, memory := newTestEncryptedCache()
+	ctx := context.Background()
+	memory.Set(ctx, "user:1", []byte(`{"cpf":"12345678909"}`), time.Minute)
+
+	_, err := c.Get(ctx, "user:1")
+	assert.EqualError(t, err, "not encrypted")
+
+	_, err = c.Get(ctx, "user:2")
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestEncryptedCacheDelete(t *testing.T) {
+	c, memory := newTestEncryptedCache()
+	ctx := context.Background()
+	c.Set(ctx, "user:1", []byte("{}"), time.Minute)
+
+	assert.NoError(t, c.Delete(ctx, "user:1"))
+
+	_, err := memory.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestGetOrLoadFallsBackToLoadWhenDecryptionFails(t *testing.T) {
+	c, memory := newTestEncryptedCache()
+	ctx := context.Background()
+	memory.Set(ctx, "item:1", []byte(`{"name":"plain"}`), time.Minute)
+
+	value, err := GetOrLoad(ctx, c, "item:1", time.Minute, func(ctx context.Context) (*item, error) {
+		return &item{Name: "loaded"}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", value.Name)
+}
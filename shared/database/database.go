@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"shared/apierror"
+	"shared/config"
+	"shared/logging"
+	"shared/metrics"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
+)
+
+// Config configures the connection, the startup retries and the connection pool
+type Config struct {
+	DSN string
+	// Name labels the connection pool statistics
+	Name string
+
+	// ConnectTimeout is how long Open keeps retrying before giving up
+	ConnectTimeout time.Duration
+	// AttemptTimeout bounds each attempt, so a server that accepts the connection but never
+	// answers cannot hold Open past ConnectTimeout
+	AttemptTimeout time.Duration
+	// RetryBackoff is the wait after the first failed attempt; it doubles up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// PrepareStmt caches the statements prepared by GORM on each connection
+	PrepareStmt bool
+	// StatementCache lets the pgx driver prepare and cache statements; disable it behind
+	// poolers such as PgBouncer in transaction mode, which do not keep statements between queries
+	StatementCache bool
+}
+
+// ConfigFromEnv returns the configuration for dsn read from the DB_* environment variables
+func ConfigFromEnv(dsn, name string) Config {
+	return Config{
+		DSN:             dsn,
+		Name:            name,
+		ConnectTimeout:  config.GetEnvDuration("DB_CONNECT_TIMEOUT", time.Minute),
+		AttemptTimeout:  config.GetEnvDuration("DB_CONNECT_ATTEMPT_TIMEOUT", 5*time.Second),
+		RetryBackoff:    config.GetEnvDuration("DB_CONNECT_RETRY_BACKOFF", 500*time.Millisecond),
+		MaxRetryBackoff: config.GetEnvDuration("DB_CONNECT_MAX_RETRY_BACKOFF", 10*time.Second),
+		MaxOpenConns:    config.GetEnvInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    config.GetEnvInt("DB_MAX_IDLE_CONNS", 10),
+		ConnMaxLifetime: config.GetEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: config.GetEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		PrepareStmt:     config.GetEnvBool("DB_PREPARE_STMT", false),
+		StatementCache:  config.GetEnvBool("DB_STATEMENT_CACHE", true),
+	}
+}
+
+// Open connects to the postgres database with query logging, tracing and metrics. While the
+// database is unreachable it retries with exponential backoff until cfg.ConnectTimeout has passed,
+// so the services can start before postgres is ready.
+func Open(cfg Config) (*gorm.DB, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Use(otelgorm.NewPlugin()); err != nil {
+		return nil, apierror.Wrap("failed to register query tracing", err)
+	}
+	if err := metrics.RegisterGormCallbacks(db); err != nil {
+		return nil, apierror.Wrap("failed to register query metrics", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, apierror.Wrap("failed to get database handle", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	metrics.RegisterDBStats(sqlDB, cfg.Name)
+	return db, nil
+}
+
+// connect opens the database, retrying until it answers or the deadline passes
+func connect(cfg Config) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := connectOnce(ctx, cfg)
+		if err == nil {
+			db.Logger = logging.NewGormLogger()
+			return db, nil
+		}
+
+		slog.Warn("database not ready, retrying", "database", cfg.Name, "attempt", attempt, "retry_in", backoff.String(), "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return nil, apierror.Wrap("failed to connect database", err)
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff, cfg.MaxRetryBackoff)
+	}
+}
+
+// connectOnce opens the database and pings it within cfg.AttemptTimeout, never past the deadline of ctx
+func connectOnce(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: cfg.DSN, PreferSimpleProtocol: !cfg.StatementCache}), &gorm.Config{
+		// failed attempts are logged by connect, once each
+		Logger:      logging.NewGormLogger().LogMode(logger.Silent),
+		PrepareStmt: cfg.PrepareStmt,
+		// unique violations surface as gorm.ErrDuplicatedKey, so callers can report them as conflicts
+		TranslateError: true,
+		// the ping below is bound to the attempt timeout instead
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		closeDB(db)
+		return nil, err
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, cfg.AttemptTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(attemptCtx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// nextBackoff doubles backoff without going over max
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// closeDB releases the pool of a connection that failed to open
+func closeDB(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
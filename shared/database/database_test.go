@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "1h")
+	t.Setenv("DB_STATEMENT_CACHE", "false")
+	t.Setenv("DB_PREPARE_STMT", "invalid")
+
+	cfg := ConfigFromEnv("host=postgres", "orderdb")
+
+	assert.Equal(t, 50, cfg.MaxOpenConns)
+	assert.Equal(t, 10, cfg.MaxIdleConns)
+	assert.Equal(t, time.Hour, cfg.ConnMaxLifetime)
+	assert.False(t, cfg.StatementCache)
+	assert.False(t, cfg.PrepareStmt)
+	assert.Equal(t, time.Minute, cfg.ConnectTimeout)
+	assert.Equal(t, 5*time.Second, cfg.AttemptTimeout)
+}
+
+func TestNextBackoffDoublesUpToMax(t *testing.T) {
+	assert.Equal(t, time.Second, nextBackoff(500*time.Millisecond, 10*time.Second))
+	assert.Equal(t, 10*time.Second, nextBackoff(8*time.Second, 10*time.Second))
+}
+
+func TestOpenGivesUpAfterConnectTimeout(t *testing.T) {
+	cfg := Config{
+		DSN:             "host=127.0.0.1 port=1 user=user dbname=test sslmode=disable connect_timeout=1",
+		Name:            "test",
+		ConnectTimeout:  300 * time.Millisecond,
+		AttemptTimeout:  time.Second,
+		RetryBackoff:    50 * time.Millisecond,
+		MaxRetryBackoff: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := Open(cfg)
+
+	assert.EqualError(t, err, "failed to connect database")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestOpenBoundsAttemptsToServersThatNeverAnswer(t *testing.T) {
+	// accepts connections but never completes the postgres handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	cfg := Config{
+		DSN:             fmt.Sprintf("host=127.0.0.1 port=%d user=user dbname=test sslmode=disable", port),
+		Name:            "test",
+		ConnectTimeout:  300 * time.Millisecond,
+		AttemptTimeout:  time.Minute,
+		RetryBackoff:    50 * time.Millisecond,
+		MaxRetryBackoff: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err = Open(cfg)
+
+	assert.EqualError(t, err, "failed to connect database")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types published by the order-api and the user-api
+const (
+	OrderCreated   = "OrderCreated"
+	OrderUpdated   = "OrderUpdated"
+	OrderCancelled = "OrderCancelled"
+	OrderDeleted   = "OrderDeleted"
+
+	UserCreated = "UserCreated"
+	UserUpdated = "UserUpdated"
+	UserDeleted = "UserDeleted"
+)
+
+// UserData is the payload of user events. It carries no personal data, only what other services
+// need to track the user's existence.
+type UserData struct {
+	ID         uint `json:"id"`
+	Anonymized bool `json:"anonymized"`
+}
+
+// Event is a domain event as delivered to brokers and subscribers
+type Event struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Handler processes an event; returning an error leaves the event to be delivered again
+type Handler func(ctx context.Context, event Event) error
+
+// Broker publishes events to subscribers. Delivery is at-least-once, so handlers must be idempotent.
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe delivers events to handler until ctx is done. Subscribers sharing a group split the events between them.
+	Subscribe(ctx context.Context, group string, handler Handler) error
+}
+
+// Tailer delivers every event published from now on to each caller, without a consumer group. Unlike
+// Subscribe it leaves nothing behind when the caller goes away: events published while nobody tails are
+// not replayed, and those whose handler fails are not delivered again.
+type Tailer interface {
+	Tail(ctx context.Context, handler Handler) error
+}
+
+// NewID returns a random UUID v4
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
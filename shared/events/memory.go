@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// memoryRetryBackoff is the wait before a group retries an event its handler failed; it doubles up to
+// memoryMaxRetryBackoff
+var (
+	memoryRetryBackoff    = time.Second
+	memoryMaxRetryBackoff = 30 * time.Second
+)
+
+// MemoryBroker delivers events to in-process subscribers. Each group has a queue of its own, so a
+// failing handler delays only its own group, which retries the event before moving on to the next one.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	groups map[string]*memoryGroup
+}
+
+// memoryGroup holds the events not yet handled by a group
+type memoryGroup struct {
+	mu          sync.Mutex
+	queue       []Event
+	ready       chan struct{}
+	subscribers int
+	// retry is false for tails, which drop the events their handler fails
+	retry bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{groups: make(map[string]*memoryGroup)}
+}
+
+// ErrNoSubscribers is returned by MemoryBroker.Publish when no group is subscribed, since the event
+// would otherwise be lost
+var ErrNoSubscribers = errors.New("no subscribers")
+
+// Publish queues the event for every group and fails only if there are none. Events still queued
+// when the last subscriber of a group goes away are lost.
+func (b *MemoryBroker) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.groups) == 0 {
+		return ErrNoSubscribers
+	}
+	for _, group := range b.groups {
+		group.push(event)
+	}
+	return nil
+}
+
+// Subscribe delivers the events of group to handler until ctx is done. Subscribers sharing a group
+// split the events between them.
+func (b *MemoryBroker) Subscribe(ctx context.Context, group string, handler Handler) error {
+	return b.subscribe(ctx, group, true, handler)
+}
+
+// Tail subscribes handler under a group of its own, so it sees every event
+func (b *MemoryBroker) Tail(ctx context.Context, handler Handler) error {
+	return b.subscribe(ctx, "tail:"+NewID(), false, handler)
+}
+
+func (b *MemoryBroker) subscribe(ctx context.Context, name string, retry bool, handler Handler) error {
+	b.mu.Lock()
+	group, ok := b.groups[name]
+	if !ok {
+		group = &memoryGroup{ready: make(chan struct{}, 1), retry: retry}
+		b.groups[name] = group
+	}
+	group.subscribers++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		if group.subscribers--; group.subscribers == 0 {
+			delete(b.groups, name)
+		}
+		b.mu.Unlock()
+	}()
+
+	for {
+		event, ok := group.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-group.ready:
+			}
+			continue
+		}
+		if err := group.deliver(ctx, name, event, handler); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver calls handler until it accepts the event, or just once for tails. It fails only when ctx is done.
+func (g *memoryGroup) deliver(ctx context.Context, name string, event Event, handler Handler) error {
+	backoff := memoryRetryBackoff
+	for {
+		err := handler(ctx, event)
+		if err == nil {
+			return nil
+		}
+		slog.WarnContext(ctx, "event handler failed", "group", name, "event_id", event.ID, "type", event.Type, "error", err.Error())
+		if !g.retry {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > memoryMaxRetryBackoff {
+			backoff = memoryMaxRetryBackoff
+		}
+	}
+}
+
+func (g *memoryGroup) push(event Event) {
+	g.mu.Lock()
+	g.queue = append(g.queue, event)
+	g.mu.Unlock()
+	select {
+	case g.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (g *memoryGroup) pop() (Event, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.queue) == 0 {
+		return Event{}, false
+	}
+	event := g.queue[0]
+	g.queue = g.queue[1:]
+	return event, true
+}
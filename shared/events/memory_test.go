@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBrokerDeliversToEveryGroup(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, 2)
+	for _, group := range []string{"webhooks", "projections"} {
+		group := group
+		go broker.Subscribe(ctx, group, func(ctx context.Context, event Event) error {
+			received <- group + ":" + event.Type
+			return nil
+		})
+	}
+	assert.Eventually(t, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.groups) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	err := broker.Publish(ctx, Event{ID: NewID(), Type: OrderCreated})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"webhooks:OrderCreated", "projections:OrderCreated"}, []string{<-received, <-received})
+}
+
+func TestMemoryBrokerRetriesFailedEventsWithoutBlockingOtherGroups(t *testing.T) {
+	defer func(backoff time.Duration) { memoryRetryBackoff = backoff }(memoryRetryBackoff)
+	memoryRetryBackoff = 10 * time.Millisecond
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failures := 2
+	search := make(chan string, 2)
+	webhooks := make(chan string, 2)
+	go broker.Subscribe(ctx, "search", func(ctx context.Context, event Event) error {
+		if failures > 0 {
+			failures--
+			return errors.New("index not ready")
+		}
+		search <- event.ID
+		return nil
+	})
+	go broker.Subscribe(ctx, "webhooks", func(ctx context.Context, event Event) error {
+		webhooks <- event.ID
+		return nil
+	})
+	assert.Eventually(t, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.groups) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, broker.Publish(ctx, Event{ID: "1", Type: OrderCreated}))
+	assert.NoError(t, broker.Publish(ctx, Event{ID: "2", Type: OrderUpdated}))
+
+	assert.Equal(t, []string{"1", "2"}, []string{<-webhooks, <-webhooks})
+	assert.Equal(t, []string{"1", "2"}, []string{<-search, <-search}, "the failed event is retried before the next one")
+	assert.Empty(t, webhooks, "groups that succeeded do not get the event again")
+}
+
+func TestMemoryBrokerFailsWithoutSubscribers(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	err := broker.Publish(context.Background(), Event{Type: OrderCreated})
+
+	assert.ErrorIs(t, err, ErrNoSubscribers)
+}
+
+func TestNewIDIsUUIDv4(t *testing.T) {
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), NewID())
+}
+
+func TestMemoryBrokerTailsDeliverEveryEventToEachCaller(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan Event, 2)
+	for i := 0; i < 2; i++ {
+		go broker.Tail(ctx, func(ctx context.Context, event Event) error {
+			received <- event
+			return nil
+		})
+	}
+	assert.Eventually(t, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.groups) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, broker.Publish(context.Background(), Event{Type: UserCreated}))
+	<-received
+	<-received
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.groups) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamBroker publishes events to a Redis Stream and consumes them through consumer groups.
+// Messages are acknowledged only after the handler succeeds; failed messages are claimed again after ClaimIdle.
+type RedisStreamBroker struct {
+	Client    *redis.Client
+	Stream    string
+	MaxLen    int64
+	ClaimIdle time.Duration
+}
+
+func NewRedisStreamBroker(client *redis.Client, stream string) *RedisStreamBroker {
+	return &RedisStreamBroker{Client: client, Stream: stream, MaxLen: 100000, ClaimIdle: 30 * time.Second}
+}
+
+func (b *RedisStreamBroker) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.Stream,
+		MaxLen: b.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": event.Type, "event": payload},
+	}).Err()
+}
+
+func (b *RedisStreamBroker) Subscribe(ctx context.Context, group string, handler Handler) error {
+	err := b.Client.XGroupCreateMkStream(ctx, b.Stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	consumer, _ := os.Hostname()
+	claimStart := "0-0"
+	for ctx.Err() == nil {
+		// Retry messages left pending by failed handlers or crashed consumers
+		claimed, next, err := b.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream: b.Stream, Group: group, Consumer: consumer, MinIdle: b.ClaimIdle, Start: claimStart, Count: 10,
+		}).Result()
+		if err == nil {
+			claimStart = next
+			b.handle(ctx, group, claimed, handler)
+		}
+
+		streams, err := b.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group: group, Consumer: consumer, Streams: []string{b.Stream, ">"}, Count: 10, Block: 5 * time.Second,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			slog.ErrorContext(ctx, "failed to read event stream", "stream", b.Stream, "error", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			b.handle(ctx, group, stream.Messages, handler)
+		}
+	}
+	return ctx.Err()
+}
+
+// Tail reads the stream without a consumer group, starting after its last entry, so no group is left
+// on the server when the caller goes away. After a read error it resumes from the last entry seen.
+func (b *RedisStreamBroker) Tail(ctx context.Context, handler Handler) error {
+	lastID := "0-0"
+	latest, err := b.Client.XRevRangeN(ctx, b.Stream, "+", "-", 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		lastID = latest[0].ID
+	}
+
+	for ctx.Err() == nil {
+		streams, err := b.Client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{b.Stream, lastID}, Count: 100, Block: 5 * time.Second,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			slog.ErrorContext(ctx, "failed to read event stream", "stream", b.Stream, "error", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				lastID = message.ID
+				event, err := b.decode(ctx, message)
+				if err != nil {
+					continue
+				}
+				if err := handler(ctx, event); err != nil {
+					slog.WarnContext(ctx, "event handler failed", "event_id", event.ID, "type", event.Type, "error", err.Error())
+				}
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// decode reads the event of a stream message, logging the messages that are malformed
+func (b *RedisStreamBroker) decode(ctx context.Context, message redis.XMessage) (Event, error) {
+	payload, _ := message.Values["event"].(string)
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		slog.ErrorContext(ctx, "discarding malformed event", "stream", b.Stream, "message_id", message.ID, "error", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (b *RedisStreamBroker) handle(ctx context.Context, group string, messages []redis.XMessage, handler Handler) {
+	for _, message := range messages {
+		event, err := b.decode(ctx, message)
+		if err != nil {
+			b.Client.XAck(ctx, b.Stream, group, message.ID)
+			continue
+		}
+		if err := handler(ctx, event); err != nil {
+			slog.WarnContext(ctx, "event handler failed", "event_id", event.ID, "type", event.Type, "group", group, "error", err.Error())
+			continue
+		}
+		b.Client.XAck(ctx, b.Stream, group, message.ID)
+	}
+}
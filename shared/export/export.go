@@ -0,0 +1,94 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Writer streams a table row by row; nothing but the current row is kept in memory
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	// Close flushes the output; the table is incomplete until it is called
+	Close() error
+}
+
+// NewWriter returns the Writer of format writing to w
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// ContentType returns the media type of format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// SelectColumns validates the requested columns against the available ones; no request selects all
+func SelectColumns(requested []string, available []string) ([]string, error) {
+	if len(requested) == 0 {
+		return available, nil
+	}
+	known := make(map[string]bool, len(available))
+	for _, column := range available {
+		known[column] = true
+	}
+	for _, column := range requested {
+		if !known[column] {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+	return requested, nil
+}
+
+// formatValue renders a cell value as text and reports whether it is a number
+func formatValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, false
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		return v.Format(time.RFC3339), false
+	case *time.Time:
+		if v == nil {
+			return "", false
+		}
+		return v.Format(time.RFC3339), false
+	default:
+		return fmt.Sprint(v), false
+	}
+}
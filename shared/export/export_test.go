@@ -0,0 +1,103 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTable(t *testing.T, format string, columns []string, rows ...[]interface{}) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteHeader(columns))
+	for _, row := range rows {
+		assert.NoError(t, w.WriteRow(row))
+	}
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	out := writeTable(t, FormatCSV, []string{"id", "item_description", "total_value", "created_at", "updated_at"},
+		[]interface{}{uint(1), "Caneta, azul", 10.5, created, (*time.Time)(nil)},
+		[]interface{}{uint(2), "=HYPERLINK(\"x\")", -3.0, created, &created},
+	)
+
+	assert.Equal(t, "id,item_description,total_value,created_at,updated_at\n"+
+		"1,\"Caneta, azul\",10.5,2024-03-01T12:00:00Z,\n"+
+		"2,\"'=HYPERLINK(\"\"x\"\")\",-3,2024-03-01T12:00:00Z,2024-03-01T12:00:00Z\n", string(out))
+}
+
+func TestEscapeFormula(t *testing.T) {
+	assert.Equal(t, "'=1+1", escapeFormula("=1+1"))
+	assert.Equal(t, "'@SUM(A1)", escapeFormula("@SUM(A1)"))
+	assert.Equal(t, "'-cmd", escapeFormula("-cmd"))
+	assert.Equal(t, "'+5511999999999", escapeFormula("+5511999999999"))
+	assert.Equal(t, "'-2+3", escapeFormula("-2+3"))
+	assert.Equal(t, "caneta", escapeFormula("caneta"))
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	out := writeTable(t, FormatNDJSON, []string{"id", "status"},
+		[]interface{}{uint(1), "created"},
+		[]interface{}{uint(2), "cancelled"},
+	)
+
+	assert.Equal(t, "{\"id\":1,\"status\":\"created\"}\n{\"id\":2,\"status\":\"cancelled\"}\n", string(out))
+}
+
+func TestXLSXWriter(t *testing.T) {
+	out := writeTable(t, FormatXLSX, []string{"id", "item_description"},
+		[]interface{}{uint(1), "Caneta <azul> & preta"},
+		[]interface{}{uint(2), "=HYPERLINK(\"x\")"},
+	)
+
+	archive, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	assert.NoError(t, err)
+	names := make([]string, len(archive.File))
+	for i, file := range archive.File {
+		names[i] = file.Name
+	}
+	assert.Equal(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+
+	sheet, err := archive.File[4].Open()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(sheet)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+	assert.Contains(t, string(content), `<row r="2"><c r="A2"><v>1</v></c><c r="B2" t="inlineStr"><is><t xml:space="preserve">Caneta &lt;azul&gt; &amp; preta</t></is></c></row>`)
+	assert.Contains(t, string(content), `<c r="B3" t="inlineStr"><is><t xml:space="preserve">&#39;=HYPERLINK(&#34;x&#34;)</t></is></c>`)
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "BA", columnName(52))
+}
+
+func TestSelectColumns(t *testing.T) {
+	available := []string{"id", "status", "total_value"}
+
+	columns, err := SelectColumns(nil, available)
+	assert.NoError(t, err)
+	assert.Equal(t, available, columns)
+
+	columns, err = SelectColumns([]string{"total_value", "id"}, available)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"total_value", "id"}, columns)
+
+	_, err = SelectColumns([]string{"id", "password"}, available)
+	assert.Error(t, err)
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	_, err := NewWriter(io.Discard, "pdf")
+	assert.Error(t, err)
+}
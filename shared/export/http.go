@@ -0,0 +1,77 @@
+package export
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseParams reads the export format and the selected columns from the query string
+func ParseParams(c *gin.Context, available []string) (string, []string, error) {
+	format := c.DefaultQuery("format", FormatCSV)
+	switch format {
+	case FormatCSV, FormatNDJSON, FormatXLSX:
+	default:
+		return "", nil, errors.New("Invalid format")
+	}
+
+	var requested []string
+	if value := c.Query("columns"); value != "" {
+		for _, column := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(column))
+		}
+	}
+	columns, err := SelectColumns(requested, available)
+	if err != nil {
+		return "", nil, errors.New("Invalid columns: " + err.Error())
+	}
+	return format, columns, nil
+}
+
+// ParseDateParam parses a date (2006-01-02) or RFC 3339 timestamp query parameter.
+// A date given as an upper bound covers the whole day.
+func ParseDateParam(c *gin.Context, name string, upperBound bool) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("Invalid " + name)
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// Stream sends the table written by write as an attachment named name. The status and headers go out
+// with the first rows, so an error after that can only cut the download short and Stream returns nil.
+// An error before anything was sent is returned for the caller to respond with.
+func Stream(c *gin.Context, name, format string, write func(Writer) error) error {
+	w, err := NewWriter(c.Writer, format)
+	if err != nil {
+		return err
+	}
+	c.Header("Content-Disposition", "attachment; filename="+name+"."+format)
+	c.Header("Content-Type", ContentType(format))
+	c.Status(http.StatusOK)
+
+	if err := write(w); err != nil {
+		c.Error(err)
+		if c.Writer.Written() {
+			c.Abort()
+			return nil
+		}
+		c.Header("Content-Disposition", "")
+		c.Header("Content-Type", "")
+		return err
+	}
+	return nil
+}
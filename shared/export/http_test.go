@@ -0,0 +1,93 @@
+package export
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return c, w
+}
+
+func TestParseParams(t *testing.T) {
+	available := []string{"id", "status", "total_value"}
+
+	c, _ := exportContext("/orders/export")
+	format, columns, err := ParseParams(c, available)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+	assert.Equal(t, available, columns)
+
+	c, _ = exportContext("/orders/export?format=xlsx&columns=total_value,%20id")
+	format, columns, err = ParseParams(c, available)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatXLSX, format)
+	assert.Equal(t, []string{"total_value", "id"}, columns)
+
+	c, _ = exportContext("/orders/export?format=pdf")
+	_, _, err = ParseParams(c, available)
+	assert.EqualError(t, err, "Invalid format")
+
+	c, _ = exportContext("/orders/export?columns=id,secret")
+	_, _, err = ParseParams(c, available)
+	assert.Error(t, err)
+}
+
+func TestParseDateParam(t *testing.T) {
+	c, _ := exportContext("/orders/export?from=2024-03-01&to=2024-03-01")
+
+	from, err := ParseDateParam(c, "from", false)
+	assert.NoError(t, err)
+	to, err := ParseDateParam(c, "to", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, to.Sub(*from))
+
+	missing, err := ParseDateParam(c, "since", false)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	c, _ = exportContext("/orders/export?from=yesterday")
+	_, err = ParseDateParam(c, "from", false)
+	assert.EqualError(t, err, "Invalid from")
+}
+
+func TestStream(t *testing.T) {
+	c, w := exportContext("/orders/export")
+
+	err := Stream(c, "orders", FormatNDJSON, func(ew Writer) error {
+		ew.WriteHeader([]string{"id"})
+		ew.WriteRow([]interface{}{uint(1)})
+		return ew.Close()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=orders.ndjson", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "{\"id\":1}\n", w.Body.String())
+}
+
+func TestStreamReturnsErrorsBeforeFirstRow(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON, FormatXLSX} {
+		c, w := exportContext("/orders/export")
+
+		err := Stream(c, "orders", format, func(ew Writer) error {
+			return errors.New("connection refused")
+		})
+
+		assert.EqualError(t, err, "connection refused", format)
+		assert.False(t, c.Writer.Written(), format)
+		assert.Empty(t, w.Body.String(), format)
+		assert.Empty(t, w.Header().Get("Content-Type"), format)
+		assert.Empty(t, w.Header().Get("Content-Disposition"), format)
+	}
+}
@@ -0,0 +1,36 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonWriter writes one JSON object per row, keyed by column
+type ndjsonWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	columns []string
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buffered := bufio.NewWriter(w)
+	return &ndjsonWriter{writer: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+func (w *ndjsonWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *ndjsonWriter) WriteRow(values []interface{}) error {
+	object := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		object[w.columns[i]] = value
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.writer.Flush()
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+func TestGormLoggerTraceSkipsSQLWhenNotLogged(t *testing.T) {
+	var output bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	rendered := 0
+	fc := func() (string, int64) {
+		rendered++
+		return "SELECT 1", 1
+	}
+
+	gormLogger := NewGormLogger()
+	gormLogger.Trace(context.Background(), time.Now(), fc, nil)
+	gormLogger.LogMode(logger.Silent).Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	gormLogger.LogMode(logger.Warn).Trace(context.Background(), time.Now(), fc, nil)
+	assert.Equal(t, 0, rendered)
+	assert.Empty(t, output.String())
+
+	gormLogger.LogMode(logger.Warn).Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	assert.Equal(t, 1, rendered)
+	assert.Contains(t, output.String(), `"msg":"query failed"`)
+	assert.Contains(t, output.String(), `"error":"boom"`)
+}
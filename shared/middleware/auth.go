@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"shared/apierror"
+	"shared/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+// Principal identifies the caller of a request
+type Principal struct {
+	Name string
+	Role string
+}
+
+// Anonymous is the principal of requests without an API key
+var Anonymous = Principal{Name: "anonymous", Role: "anonymous"}
+
+// LoadAPIKeys parses API_KEYS, formatted as "name:role:key,name:role:key"
+func LoadAPIKeys() map[string]Principal {
+	keys := make(map[string]Principal)
+	for _, entry := range strings.Split(config.GetEnv("API_KEYS", ""), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			continue
+		}
+		keys[parts[2]] = Principal{Name: parts[0], Role: parts[1]}
+	}
+	return keys
+}
+
+// Authenticate resolves the X-API-Key header into a Principal; requests without a key are anonymous
+func Authenticate() gin.HandlerFunc {
+	keys := LoadAPIKeys()
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" {
+			c.Set(principalKey, Anonymous)
+			c.Next()
+			return
+		}
+
+		principal, ok := keys[apiKey]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, apierror.ErrorResponse{Error: "Invalid API key"})
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// GetPrincipal returns the caller of the request
+func GetPrincipal(c *gin.Context) Principal {
+	if value, ok := c.Get(principalKey); ok {
+		if principal, ok := value.(Principal); ok {
+			return principal
+		}
+	}
+	return Anonymous
+}
+
+// HasRole reports whether the principal has one of the given roles
+func (p Principal) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		if r == p.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the caller has one of the given roles
+func HasRole(c *gin.Context, roles ...string) bool {
+	return GetPrincipal(c).HasRole(roles...)
+}
+
+// RolesFromEnv returns the roles listed in the environment variable key, separated by commas. Without
+// the variable it returns defaults, or "admin" when no defaults are given.
+func RolesFromEnv(key string, defaults ...string) []string {
+	if len(defaults) == 0 {
+		defaults = []string{"admin"}
+	}
+	var roles []string
+	for _, role := range strings.Split(config.GetEnv(key, strings.Join(defaults, ",")), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// CanViewAudit reports whether the caller may query the audit log
+func CanViewAudit(c *gin.Context) bool {
+	return HasRole(c, RolesFromEnv("AUDIT_AUTHORIZED_ROLES")...)
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolesFromEnv(t *testing.T) {
+	assert.Equal(t, []string{"admin"}, RolesFromEnv("TEST_AUTHORIZED_ROLES"))
+	assert.Equal(t, []string{"admin", "service"}, RolesFromEnv("TEST_AUTHORIZED_ROLES", "admin", "service"))
+
+	t.Setenv("TEST_AUTHORIZED_ROLES", " admin, service ,,support")
+	assert.Equal(t, []string{"admin", "service", "support"}, RolesFromEnv("TEST_AUTHORIZED_ROLES", "admin", "service"))
+}
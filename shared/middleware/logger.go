@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"shared/apierror"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Logger writes one structured log entry per request. Errors attached with c.Error are included
+// together with their root cause, which is never sent to the client.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", c.ClientIP(),
+			"request_id", GetRequestID(c),
+			"actor", GetPrincipal(c).Name,
+		}
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+			attrs = append(attrs, "trace_id", spanContext.TraceID().String())
+		}
+
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.Last().Err.Error(), "cause", apierror.RootCause(c.Errors.Last().Err).Error())
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			slog.ErrorContext(c.Request.Context(), "request", attrs...)
+		case status >= http.StatusBadRequest:
+			slog.WarnContext(c.Request.Context(), "request", attrs...)
+		default:
+			slog.InfoContext(c.Request.Context(), "request", attrs...)
+		}
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "panic recovered", "panic", recovered, "request_id", GetRequestID(c))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Internal server error"})
+	})
+}
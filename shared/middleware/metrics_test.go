@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"shared/metrics"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCountsRequestsByRoute(t *testing.T) {
+	router := gin.Default()
+	router.Use(Metrics())
+	router.GET("/orders/:id", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	// the counters are global, so only the requests of this run are counted
+	matched := metrics.HTTPRequests.WithLabelValues("GET", "/orders/:id", "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	matchedBefore, unmatchedBefore := testutil.ToFloat64(matched), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/orders/1", "/orders/2", "/missing"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(matched)-matchedBefore)
+	assert.Equal(t, float64(1), testutil.ToFloat64(unmatched)-unmatchedBefore)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"shared/apierror"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseRouteTimeouts parses per-route deadlines formatted as "<METHOD> <route>=<duration>" separated by
+// commas. The special route "default" applies to routes without their own deadline, and a duration of 0
+// disables the deadline of a route.
+// Example: "GET /orders/export=0,default=10s"
+func ParseRouteTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		index := strings.LastIndex(entry, "=")
+		if index < 0 {
+			return nil, fmt.Errorf("invalid route timeout %q", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(entry[index+1:]))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid route timeout duration %q", entry[index+1:])
+		}
+		timeouts[strings.Join(strings.Fields(entry[:index]), " ")] = timeout
+	}
+	return timeouts, nil
+}
+
+// Timeout sets a deadline on the request context, so the queries and downstream calls made with it are
+// cancelled when the route takes too long. Routes without an entry in timeouts use timeouts["default"];
+// without a default they have no deadline. Errors written after the deadline passed are turned into 504
+// responses, since a query cancelled by the deadline may surface as a client error such as a 404.
+func Timeout(timeouts map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := timeouts[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = timeouts["default"]
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		writer := c.Writer
+		c.Writer = &timeoutWriter{ResponseWriter: writer, ctx: ctx}
+		c.Next()
+		c.Writer = writer
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, apierror.ErrorResponse{Error: "Request timed out"})
+		}
+	}
+}
+
+// timeoutWriter reports the errors written after the request deadline as gateway timeouts
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"shared/apierror"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutCancelsRequestContext(t *testing.T) {
+	router := gin.New()
+	router.Use(Timeout(map[string]time.Duration{"GET /export": 0, "default": 10 * time.Millisecond}))
+	router.GET("/orders", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: c.Request.Context().Err().Error()})
+	})
+	router.GET("/orders/:id", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "Order not found"})
+	})
+	router.GET("/silent", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	router.GET("/export", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/orders", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(t, `{"error":"context deadline exceeded"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/orders/1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/silent", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(t, `{"error":"Request timed out"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/export", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deadline":false}`, w.Body.String())
+}
+
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts, err := ParseRouteTimeouts("GET  /orders/export=0, default=10s")
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), timeouts["GET /orders/export"])
+	assert.Equal(t, 10*time.Second, timeouts["default"])
+
+	_, err = ParseRouteTimeouts("GET /orders=ten")
+	assert.Error(t, err)
+	_, err = ParseRouteTimeouts("default=-1s")
+	assert.Error(t, err)
+}
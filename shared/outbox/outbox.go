@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"shared/events"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event is a domain event stored in the same transaction as the change that caused it
+// and published later by the relay
+type Event struct {
+	ID            uint   `gorm:"primaryKey"`
+	EventID       string `gorm:"uniqueIndex"`
+	Type          string
+	AggregateType string
+	AggregateID   string
+	Payload       string `gorm:"type:jsonb"`
+	CreatedAt     time.Time
+	PublishedAt   *time.Time `gorm:"index"`
+	Attempts      int
+	LastError     string
+}
+
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Enqueue writes a domain event about an aggregate into the outbox using tx,
+// so the event is stored if and only if the change is committed
+func Enqueue(tx *gorm.DB, eventType, aggregateType string, aggregateID uint, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&Event{
+		EventID:       events.NewID(),
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   fmt.Sprint(aggregateID),
+		Payload:       string(payload),
+	}).Error
+}
+
+// Relay publishes the events stored in the outbox to a broker, in insertion order.
+// An event is marked as published only after the broker accepts it, so delivery is at-least-once.
+type Relay struct {
+	DB           *gorm.DB
+	Broker       events.Broker
+	PollInterval time.Duration
+	BatchSize    int
+	// Retention is how long published events are kept before Prune deletes them; zero keeps them forever.
+	// The payloads are snapshots of the aggregates, so they must not outlive the erasure of their data.
+	Retention time.Duration
+}
+
+// Run polls the outbox and prunes the published events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.PublishPending(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to publish outbox events", "error", err.Error())
+			}
+			if _, err := r.Prune(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to prune outbox events", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Prune deletes the events published more than Retention ago and returns how many were deleted
+func (r *Relay) Prune(ctx context.Context) (int64, error) {
+	if r.Retention <= 0 {
+		return 0, nil
+	}
+	result := r.DB.WithContext(ctx).Where("published_at < ?", time.Now().Add(-r.Retention)).Delete(&Event{})
+	return result.RowsAffected, result.Error
+}
+
+// PublishPending publishes one batch of unpublished events and returns how many were published.
+// The batch stays locked until it is published, so the relays of several instances take turns
+// instead of publishing later events of an aggregate before earlier ones.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	published := 0
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending []Event
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("published_at IS NULL").Order("id").Limit(r.BatchSize).Find(&pending).Error; err != nil {
+			return err
+		}
+
+		for i := range pending {
+			event := pending[i]
+			publishErr := r.Broker.Publish(ctx, events.Event{
+				ID:            event.EventID,
+				Type:          event.Type,
+				AggregateType: event.AggregateType,
+				AggregateID:   event.AggregateID,
+				OccurredAt:    event.CreatedAt,
+				Data:          json.RawMessage(event.Payload),
+			})
+			if publishErr != nil {
+				// Stop at the first failure to keep events of the same aggregate in sequence
+				return tx.Model(&event).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": publishErr.Error(),
+				}).Error
+			}
+
+			now := time.Now()
+			if err := tx.Model(&event).Updates(map[string]interface{}{
+				"published_at": now,
+				"attempts":     gorm.Expr("attempts + 1"),
+			}).Error; err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"shared/database/databasetest"
+	"shared/events"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// recordingBroker accepts events until failOn is published
+type recordingBroker struct {
+	published []events.Event
+	failOn    string
+}
+
+func (b *recordingBroker) Publish(ctx context.Context, event events.Event) error {
+	if event.AggregateID == b.failOn {
+		return errors.New("broker unavailable")
+	}
+	b.published = append(b.published, event)
+	return nil
+}
+
+func (b *recordingBroker) Subscribe(ctx context.Context, group string, handler events.Handler) error {
+	return nil
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	return databasetest.Open(t, &Event{})
+}
+
+func TestRelayPublishesPendingEventsInOrder(t *testing.T) {
+	db := newTestDB(t)
+	for id := uint(1); id <= 3; id++ {
+		require.NoError(t, Enqueue(db, events.OrderCreated, "order", id, map[string]uint{"id": id}))
+	}
+	broker := &recordingBroker{}
+	relay := Relay{DB: db, Broker: broker, BatchSize: 2}
+
+	published, err := relay.PublishPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+
+	published, err = relay.PublishPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	require.Len(t, broker.published, 3)
+	for i, event := range broker.published {
+		assert.Equal(t, events.OrderCreated, event.Type)
+		assert.Equal(t, "order", event.AggregateType)
+		assert.Equal(t, []string{"1", "2", "3"}[i], event.AggregateID)
+		assert.JSONEq(t, `{"id":`+event.AggregateID+`}`, string(event.Data))
+	}
+
+	var pending int64
+	db.Model(&Event{}).Where("published_at IS NULL").Count(&pending)
+	assert.Zero(t, pending)
+}
+
+func TestRelayStopsAtFirstFailureAndRetries(t *testing.T) {
+	db := newTestDB(t)
+	for id := uint(1); id <= 3; id++ {
+		require.NoError(t, Enqueue(db, events.OrderUpdated, "order", id, nil))
+	}
+	broker := &recordingBroker{failOn: "2"}
+	relay := Relay{DB: db, Broker: broker, BatchSize: 10}
+
+	published, err := relay.PublishPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	var failed Event
+	require.NoError(t, db.Where("aggregate_id = ?", "2").First(&failed).Error)
+	assert.Nil(t, failed.PublishedAt)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "broker unavailable", failed.LastError)
+
+	var third Event
+	require.NoError(t, db.Where("aggregate_id = ?", "3").First(&third).Error)
+	assert.Nil(t, third.PublishedAt, "events after a failure wait so they stay in sequence")
+
+	broker.failOn = ""
+	published, err = relay.PublishPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []string{"1", "2", "3"}, []string{broker.published[0].AggregateID, broker.published[1].AggregateID, broker.published[2].AggregateID})
+}
+
+func TestRelayKeepsEventsWithoutSubscribersPending(t *testing.T) {
+	db := newTestDB(t)
+	require.NoError(t, Enqueue(db, events.UserCreated, "user", 1, events.UserData{ID: 1}))
+	relay := Relay{DB: db, Broker: events.NewMemoryBroker(), BatchSize: 10}
+
+	published, err := relay.PublishPending(context.Background())
+
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	var event Event
+	require.NoError(t, db.First(&event).Error)
+	assert.Nil(t, event.PublishedAt)
+	assert.Equal(t, events.ErrNoSubscribers.Error(), event.LastError)
+}
+
+func TestRelayPrunesEventsPublishedBeforeRetention(t *testing.T) {
+	db := newTestDB(t)
+	for id := uint(1); id <= 3; id++ {
+		require.NoError(t, Enqueue(db, events.OrderCreated, "order", id, nil))
+	}
+	require.NoError(t, db.Model(&Event{}).Where("aggregate_id = ?", "1").Update("published_at", time.Now().Add(-48*time.Hour)).Error)
+	require.NoError(t, db.Model(&Event{}).Where("aggregate_id = ?", "2").Update("published_at", time.Now()).Error)
+	relay := Relay{DB: db, Retention: 24 * time.Hour}
+
+	pruned, err := relay.Prune(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+	var remaining []string
+	db.Model(&Event{}).Order("id").Pluck("aggregate_id", &remaining)
+	assert.Equal(t, []string{"2", "3"}, remaining)
+}
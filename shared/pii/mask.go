@@ -0,0 +1,45 @@
+// Package pii masks personal data for callers that may not see it in full
+package pii
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaskCPF formats a CPF hiding all but the last five digits (***.***.123-45)
+func MaskCPF(cpf string) string {
+	digits := onlyDigits(cpf)
+	if len(digits) != 11 {
+		return "***.***.***-**"
+	}
+	return fmt.Sprintf("***.***.%s-%s", digits[6:9], digits[9:])
+}
+
+// MaskPhone hides all but the last four digits of a phone number
+func MaskPhone(phone string) string {
+	digits := onlyDigits(phone)
+	if len(digits) <= 4 {
+		return strings.Repeat("*", len(digits))
+	}
+	return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+}
+
+// MaskEmail keeps the first character of the local part and the domain
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func onlyDigits(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
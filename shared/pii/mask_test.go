@@ -0,0 +1,17 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "***.***.789-09", MaskCPF("123.456.789-09"))
+	assert.Equal(t, "***.***.***-**", MaskCPF("123"))
+	assert.Equal(t, "*******5678", MaskPhone("(11) 91234-5678"))
+	assert.Equal(t, "***", MaskPhone("123"))
+	assert.Equal(t, "j***@example.com", MaskEmail("john@example.com"))
+	assert.Equal(t, "***", MaskEmail("@example.com"))
+	assert.Equal(t, "***", MaskEmail("john"))
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"shared/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// New returns a Gin engine with the middleware every API runs: tracing, request IDs, request
+// logging, panic recovery, metrics and API key authentication, in that order
+func New(serviceName string) *gin.Engine {
+	r := gin.New()
+	r.Use(otelgin.Middleware(serviceName))
+	r.Use(middleware.RequestID(), middleware.Logger(), middleware.Recovery(), middleware.Metrics())
+	r.Use(middleware.Authenticate())
+	return r
+}
+
+// Run adds the Swagger UI and the Prometheus metrics to r and serves it on addr. The Swagger
+// document is the one registered by the service's docs package.
+func Run(r *gin.Engine, addr string) error {
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return r.Run(addr)
+}
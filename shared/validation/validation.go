@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// New returns a validator for the `validate` struct tags
+func New() *validator.Validate {
+	return validator.New()
+}
+
+// Error formats validator errors as "Field: tag, Field: tag"; other errors are returned as is
+func Error(err error) error {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	errorMessages := make(map[string]string)
+	for _, err := range validationErrors {
+		errorMessages[err.Field()] = err.Tag()
+	}
+	var sb strings.Builder
+	for field, tag := range errorMessages {
+		sb.WriteString(fmt.Sprintf("%s: %s, ", field, tag))
+	}
+	errorMsg := strings.TrimRight(sb.String(), ", ")
+	return errors.New(errorMsg)
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"shared/apierror"
+	"shared/export"
+	"strings"
+	"user-api/middleware"
+	"user-api/models"
+	"user-api/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportUsers godoc
+// @Summary Export users
+// @Description Stream the users matching the filters, in ID order, as CSV, NDJSON or XLSX. Rows are read from a database cursor and written as they arrive, so any number of users can be exported. CPF, email and phone number are masked unless the API key has an authorized role, which is also required to filter by them
+// @Tags users
+// @Security ApiKeyAuth
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "File format" Enums(csv, ndjson, xlsx) default(csv)
+// @Param columns query string false "Comma-separated columns, all by default" example(id,name,created_at)
+// @Param name query string false "Part of the name"
+// @Param email query string false "Email"
+// @Param phone query string false "Phone number"
+// @Param cpf query string false "CPF"
+// @Param from query string false "Created at or after (date or RFC 3339)"
+// @Param to query string false "Created before (RFC 3339), or on or before (date)"
+// @Success 200 {file} file
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /users/export [get]
+func ExportUsers(db *gorm.DB) gin.HandlerFunc {
+	service := services.UserService{DB: db}
+	return func(c *gin.Context) {
+		format, columns, err := export.ParseParams(c, services.UserExportColumns)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		filter := models.UserExportFilter{
+			Name:  strings.TrimSpace(c.Query("name")),
+			Email: strings.TrimSpace(c.Query("email")),
+			Phone: strings.TrimSpace(c.Query("phone")),
+			CPF:   strings.TrimSpace(c.Query("cpf")),
+		}
+		full := middleware.CanViewPII(c)
+		if (filter.Email != "" || filter.Phone != "" || filter.CPF != "") && !full {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+		if filter.From, err = export.ParseDateParam(c, "from", false); err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if filter.To, err = export.ParseDateParam(c, "to", true); err != nil {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		err = export.Stream(c, "users", format, func(w export.Writer) error {
+			return service.ExportUsers(c.Request.Context(), filter, columns, full, w)
+		})
+		if errors.Is(err, services.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to export users"})
+		}
+	}
+}
@@ -1,7 +1,19 @@
 package controllers
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
+	"shared/config"
+	"strconv"
+	"strings"
+	"user-api/middleware"
 	"user-api/models"
 	"user-api/services"
 
@@ -9,44 +21,138 @@ import (
 	"gorm.io/gorm"
 )
 
+// parseUserIDs parses a comma-separated list of user IDs, dropping repeated IDs
+func parseUserIDs(value string) ([]uint, error) {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil || id == 0 {
+			return nil, errors.New("Invalid ids")
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
 // GetUsers godoc
 // @Summary Get all users
-// @Description Get all users
+// @Description Get all users, or only the users listed in ids in a single lookup; IDs without a user are left out of the response. CPF, email and phone number are masked unless the API key has an authorized role
 // @Tags users
+// @Security ApiKeyAuth
 // @Produce json
-// @Success 200 {array} models.User
-// @Failure 500 {object} models.ErrorResponse
+// @Param ids query string false "Comma-separated user IDs (up to USER_LOOKUP_MAX_IDS, default 100)" example(1,2,3)
+// @Success 200 {array} models.UserResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
 // @Router /users [get]
 func GetUsers(db *gorm.DB) gin.HandlerFunc {
 	service := services.UserService{DB: db}
+	maxIDs := config.GetEnvInt("USER_LOOKUP_MAX_IDS", 100)
 	return func(c *gin.Context) {
-		users, err := service.GetAllUsers()
+		var users []models.User
+		var err error
+		if value, ok := c.GetQuery("ids"); ok {
+			ids, parseErr := parseUserIDs(value)
+			if parseErr != nil {
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: parseErr.Error()})
+				return
+			}
+			if len(ids) > maxIDs {
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: fmt.Sprintf("At most %d ids are allowed", maxIDs)})
+				return
+			}
+			users, err = service.GetUsersByIDs(c.Request.Context(), ids)
+		} else {
+			users, err = service.GetAllUsers(c.Request.Context())
+		}
 		if err != nil {
+			c.Error(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		c.JSON(http.StatusOK, models.NewUserResponses(users, middleware.CanViewPII(c)))
+	}
+}
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Search users by partial name, exact email, phone number or CPF in any formatting; every criterion given must match. Email, phone and CPF lookups require an authorized role. CPF, email and phone number are masked unless the API key has an authorized role
+// @Tags users
+// @Security ApiKeyAuth
+// @Produce json
+// @Param name query string false "Part of the name, typos tolerated"
+// @Param email query string false "Email"
+// @Param phone query string false "Phone number"
+// @Param cpf query string false "CPF"
+// @Param limit query int false "Maximum number of users (up to 100)" default(20)
+// @Success 200 {array} models.UserResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Router /users/search [get]
+func SearchUsers(db *gorm.DB) gin.HandlerFunc {
+	service := services.UserService{DB: db}
+	return func(c *gin.Context) {
+		query := models.UserSearchQuery{
+			Name:  strings.TrimSpace(c.Query("name")),
+			Email: strings.TrimSpace(c.Query("email")),
+			Phone: strings.TrimSpace(c.Query("phone")),
+			CPF:   strings.TrimSpace(c.Query("cpf")),
+		}
+		if query == (models.UserSearchQuery{}) {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "At least one of name, email, phone or cpf is required"})
+			return
+		}
+		if (query.Email != "" || query.Phone != "" || query.CPF != "") && !middleware.CanViewPII(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid limit"})
+			return
+		}
+		query.Limit = limit
+
+		users, err := service.SearchUsers(c.Request.Context(), query)
+		if err != nil {
+			c.Error(err)
+			if errors.Is(err, services.ErrInvalidSearch) {
+				c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to search users"})
+			return
+		}
+		c.JSON(http.StatusOK, models.NewUserResponses(users, middleware.CanViewPII(c)))
 	}
 }
 
 // GetUserByID godoc
 // @Summary Get user by ID
-// @Description Get a specific user by ID
+// @Description Get a specific user by ID. CPF, email and phone number are masked unless the API key has an authorized role
 // @Tags users
+// @Security ApiKeyAuth
 // @Produce json
 // @Param id path int true "User ID"
-// @Success 200 {object} models.User
-// @Failure 404 {object} models.ErrorResponse
+// @Success 200 {object} models.UserResponse
+// @Failure 404 {object} apierror.ErrorResponse
 // @Router /users/{id} [get]
-func GetUserByID(db *gorm.DB) gin.HandlerFunc {
-	service := services.UserService{DB: db}
+func GetUserByID(db *gorm.DB, userCache cache.Cache) gin.HandlerFunc {
+	service := services.UserService{DB: db, Cache: userCache}
 	return func(c *gin.Context) {
-		user, err := service.GetUserByID(c.Param("id"))
+		user, err := service.GetUserByID(c.Request.Context(), c.Param("id"))
 		if err != nil {
+			c.Error(err)
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, models.NewUserResponse(user, middleware.CanViewPII(c)))
 	}
 }
 
@@ -54,17 +160,19 @@ func GetUserByID(db *gorm.DB) gin.HandlerFunc {
 // @Summary Create a new user
 // @Description Create a new user
 // @Tags users
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param UserRequest body models.UserRequest true "UserRequest"
-// @Success 201 {object} models.User
-// @Failure 400 {object} models.ErrorResponse
+// @Success 201 {object} models.UserResponse
+// @Failure 400 {object} apierror.ErrorResponse
 // @Router /users [post]
 func CreateUser(db *gorm.DB) gin.HandlerFunc {
-	service := services.UserService{DB: db}
 	return func(c *gin.Context) {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c)}
 		var userRequest models.UserRequest
 		if err := c.ShouldBindJSON(&userRequest); err != nil {
+			c.Error(err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -76,12 +184,71 @@ func CreateUser(db *gorm.DB) gin.HandlerFunc {
 			PhoneNumber: userRequest.PhoneNumber,
 		}
 
-		if err := service.CreateUser(&user); err != nil {
+		if err := service.CreateUser(c.Request.Context(), &user); err != nil {
+			c.Error(err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusCreated, user)
+		c.JSON(http.StatusCreated, models.NewUserResponse(&user, middleware.CanViewPII(c)))
+	}
+}
+
+// CreateUsers godoc
+// @Summary Create users in batch
+// @Description Create up to BATCH_MAX_USERS users and return a 207 with the result of each one, in order. Duplicated CPFs and emails are rejected within the batch and against existing users. In atomic mode nothing is created unless every user is valid; in best_effort mode each valid user is created
+// @Tags users
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param mode query string false "Batch mode" Enums(best_effort, atomic) default(best_effort)
+// @Param UserRequest body []models.UserRequest true "Users"
+// @Success 207 {object} models.BatchUserResponse
+// @Failure 400 {object} apierror.ErrorResponse
+// @Router /users/batch [post]
+func CreateUsers(db *gorm.DB) gin.HandlerFunc {
+	maxUsers := config.GetEnvInt("BATCH_MAX_USERS", 500)
+	return func(c *gin.Context) {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c)}
+
+		mode := c.DefaultQuery("mode", "best_effort")
+		if mode != "best_effort" && mode != "atomic" {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: "Invalid mode"})
+			return
+		}
+
+		var requests []models.UserRequest
+		if err := c.ShouldBindJSON(&requests); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if len(requests) == 0 || len(requests) > maxUsers {
+			c.JSON(http.StatusBadRequest, apierror.ErrorResponse{Error: fmt.Sprintf("A batch must have between 1 and %d users", maxUsers)})
+			return
+		}
+
+		users := make([]models.User, len(requests))
+		for i, request := range requests {
+			users[i] = models.User{
+				Name:        request.Name,
+				CPF:         request.CPF,
+				Email:       request.Email,
+				PhoneNumber: request.PhoneNumber,
+			}
+		}
+
+		response := models.BatchUserResponse{Mode: mode, Results: service.CreateUsers(c.Request.Context(), users, mode == "atomic")}
+		for i := range response.Results {
+			if response.Results[i].Status != http.StatusCreated {
+				response.Failed++
+				continue
+			}
+			user := models.NewUserResponse(&users[i], middleware.CanViewPII(c))
+			response.Results[i].User = &user
+			response.Created++
+		}
+		c.JSON(http.StatusMultiStatus, response)
 	}
 }
 
@@ -89,18 +256,20 @@ func CreateUser(db *gorm.DB) gin.HandlerFunc {
 // @Summary Update a user
 // @Description Update an existing user by ID
 // @Tags users
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Param UserRequest body models.UserRequest true "UserRequest"
-// @Success 200 {object} models.User
-// @Failure 400 {object} models.ErrorResponse
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} apierror.ErrorResponse
 // @Router /users/{id} [put]
-func UpdateUser(db *gorm.DB) gin.HandlerFunc {
-	service := services.UserService{DB: db}
+func UpdateUser(db *gorm.DB, userCache cache.Cache) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c), Cache: userCache}
 		var userRequest models.UserRequest
 		if err := c.ShouldBindJSON(&userRequest); err != nil {
+			c.Error(err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -112,13 +281,14 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 			PhoneNumber: userRequest.PhoneNumber,
 		}
 
-		updatedUser, err := service.UpdateUser(c.Param("id"), &user)
+		updatedUser, err := service.UpdateUser(c.Request.Context(), c.Param("id"), &user)
 		if err != nil {
+			c.Error(err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, updatedUser)
+		c.JSON(http.StatusOK, models.NewUserResponse(updatedUser, middleware.CanViewPII(c)))
 	}
 }
 
@@ -126,17 +296,140 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 // @Summary Delete a user
 // @Description Delete a user by ID
 // @Tags users
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
-// @Success 200 {object} models.ErrorResponse
-// @Failure 404 {object} models.ErrorResponse
+// @Success 200 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
 // @Router /users/{id} [delete]
-func DeleteUser(db *gorm.DB) gin.HandlerFunc {
-	service := services.UserService{DB: db}
+func DeleteUser(db *gorm.DB, userCache cache.Cache) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := service.DeleteUser(c.Param("id")); err != nil {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c), Cache: userCache}
+		if err := service.DeleteUser(c.Request.Context(), c.Param("id")); err != nil {
+			c.Error(err)
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 	}
 }
+
+// ExportUserData godoc
+// @Summary Export a user's personal data
+// @Description Export the user record and all of the user's orders (LGPD data portability). Requires an authorized role
+// @Tags lgpd
+// @Security ApiKeyAuth
+// @Produce json
+// @Produce application/zip
+// @Param id path int true "User ID"
+// @Param format query string false "Bundle format" Enums(json, zip)
+// @Success 200 {object} models.DataExport
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Failure 502 {object} apierror.ErrorResponse
+// @Router /users/{id}/data-export [get]
+func ExportUserData(db *gorm.DB, userCache cache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c), Cache: userCache}
+		if !middleware.CanViewPII(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		export, err := service.ExportUserData(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "User not found"})
+				return
+			}
+			if errors.Is(err, services.ErrOrderAPI) {
+				c.JSON(http.StatusBadGateway, apierror.ErrorResponse{Error: "Failed to fetch user orders"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to export user data"})
+			return
+		}
+
+		if c.Query("format") != "zip" {
+			c.JSON(http.StatusOK, export)
+			return
+		}
+
+		bundle, err := zipDataExport(export)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: "Failed to build export"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=user-%d-data-export.zip", export.User.ID))
+		c.Data(http.StatusOK, "application/zip", bundle)
+	}
+}
+
+// zipDataExport packs the export into a ZIP with one JSON file per entity
+func zipDataExport(export *models.DataExport) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := map[string]interface{}{
+		"user.json":   export.User,
+		"orders.json": export.Orders,
+		"export.json": gin.H{"generated_at": export.GeneratedAt},
+	}
+	for name, content := range files {
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EraseUser godoc
+// @Summary Erase a user's personal data
+// @Description Anonymize the user and pseudonymize the user's orders, keeping financial totals (LGPD erasure). Requires an authorized role
+// @Tags lgpd
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.ErasureResult
+// @Failure 403 {object} apierror.ErrorResponse
+// @Failure 404 {object} apierror.ErrorResponse
+// @Failure 500 {object} apierror.ErrorResponse
+// @Failure 502 {object} apierror.ErrorResponse
+// @Router /users/{id}/erasure [post]
+func EraseUser(db *gorm.DB, userCache cache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.UserService{DB: db, Audit: audit.RequestMetadata(c), Cache: userCache}
+		if !middleware.CanViewPII(c) {
+			c.JSON(http.StatusForbidden, apierror.ErrorResponse{Error: "Forbidden"})
+			return
+		}
+
+		result, err := service.EraseUser(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Error(err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, apierror.ErrorResponse{Error: "User not found"})
+				return
+			}
+			if errors.Is(err, services.ErrOrderAPI) {
+				c.JSON(http.StatusBadGateway, apierror.ErrorResponse{Error: "Failed to pseudonymize user orders"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apierror.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,120 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"shared/logging"
+	"shared/middleware"
+	"time"
+	"user-api/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller of a gRPC call
+func PrincipalFromContext(ctx context.Context) middleware.Principal {
+	if principal, ok := ctx.Value(principalKey{}).(middleware.Principal); ok {
+		return principal
+	}
+	return middleware.Anonymous
+}
+
+// authenticate resolves the x-api-key metadata into a Principal, the same way the REST API
+// resolves X-API-Key, and carries the x-request-id metadata (or a new ID) in the returned context
+func authenticate(ctx context.Context, keys map[string]middleware.Principal) (context.Context, middleware.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := first(md, "x-request-id")
+	if requestID == "" || len(requestID) > middleware.MaxRequestIDLen {
+		requestID = middleware.NewRequestID()
+	}
+	ctx = logging.ContextWithRequestID(ctx, requestID)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+
+	principal := middleware.Anonymous
+	if apiKey := first(md, "x-api-key"); apiKey != "" {
+		known, ok := keys[apiKey]
+		if !ok {
+			return ctx, principal, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		principal = known
+	}
+	return context.WithValue(ctx, principalKey{}, principal), principal, nil
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// observe logs a finished call and records its metrics
+func observe(ctx context.Context, method string, principal middleware.Principal, start time.Time, err error) {
+	code := status.Code(err)
+	duration := time.Since(start)
+	metrics.GRPCRequests.WithLabelValues(method, code.String()).Inc()
+	metrics.GRPCRequestDuration.WithLabelValues(method, code.String()).Observe(duration.Seconds())
+
+	attrs := []any{
+		"method", method,
+		"code", code.String(),
+		"duration_ms", float64(duration.Microseconds()) / 1000,
+		"request_id", logging.RequestIDFromContext(ctx),
+		"actor", principal.Name,
+	}
+	if err != nil {
+		attrs = append(attrs, "error", status.Convert(err).Message())
+	}
+	switch code {
+	case codes.OK, codes.Canceled:
+		slog.InfoContext(ctx, "grpc call", attrs...)
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		slog.ErrorContext(ctx, "grpc call", attrs...)
+	default:
+		slog.WarnContext(ctx, "grpc call", attrs...)
+	}
+}
+
+// UnaryInterceptor authenticates, logs and measures unary calls
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	keys := middleware.LoadAPIKeys()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx, principal, err := authenticate(ctx, keys)
+		var resp any
+		if err == nil {
+			resp, err = handler(ctx, req)
+		}
+		observe(ctx, info.FullMethod, principal, start, err)
+		return resp, err
+	}
+}
+
+// authenticatedStream replaces the context of a server stream
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamInterceptor authenticates, logs and measures streaming calls
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	keys := middleware.LoadAPIKeys()
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, principal, err := authenticate(stream.Context(), keys)
+		if err == nil {
+			err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+		}
+		observe(ctx, info.FullMethod, principal, start, err)
+		return err
+	}
+}
@@ -0,0 +1,173 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"shared/apierror"
+	"shared/cache"
+	"shared/logging"
+	"strconv"
+	"time"
+	"user-api/middleware"
+	"user-api/models"
+	"user-api/services"
+
+	userv1 "user-api/gen/user/v1"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// UserServer implements the gRPC UserService on top of services.UserService
+type UserServer struct {
+	userv1.UnimplementedUserServiceServer
+	DB *gorm.DB
+	// Cache is shared with the REST routes so both see the same invalidations. Nil disables caching.
+	Cache cache.Cache
+	// Hub delivers the user events to WatchUsers
+	Hub *Hub
+	// MaxBatch is the maximum number of IDs accepted by BatchGetUsers
+	MaxBatch int
+}
+
+func (s *UserServer) service() *services.UserService {
+	return &services.UserService{DB: s.DB, Cache: s.Cache}
+}
+
+// GetUser returns a user, masking PII unless the caller has an authorized role
+func (s *UserServer) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
+	if req.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	user, err := s.service().GetUserByID(ctx, strconv.FormatUint(uint64(req.Id), 10))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch user", err)
+	}
+	return &userv1.GetUserResponse{User: newUser(user, canViewPII(ctx))}, nil
+}
+
+// BatchGetUsers returns the users among the given IDs in a single query
+func (s *UserServer) BatchGetUsers(ctx context.Context, req *userv1.BatchGetUsersRequest) (*userv1.BatchGetUsersResponse, error) {
+	seen := make(map[uint32]bool, len(req.Ids))
+	var ids []uint
+	for _, id := range req.Ids {
+		if id == 0 {
+			return nil, status.Error(codes.InvalidArgument, "ids must be positive")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) > s.MaxBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ids are allowed", s.MaxBatch)
+	}
+	if len(ids) == 0 {
+		return &userv1.BatchGetUsersResponse{}, nil
+	}
+
+	users, err := s.service().GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch users", err)
+	}
+	full := canViewPII(ctx)
+	response := &userv1.BatchGetUsersResponse{Users: make([]*userv1.User, 0, len(users))}
+	for i := range users {
+		response.Users = append(response.Users, newUser(&users[i], full))
+	}
+	return response, nil
+}
+
+// UserExists reports whether there is a user with the ID whose data has not been erased
+func (s *UserServer) UserExists(ctx context.Context, req *userv1.UserExistsRequest) (*userv1.UserExistsResponse, error) {
+	if req.Id == 0 {
+		return &userv1.UserExistsResponse{Exists: false}, nil
+	}
+	user, err := s.service().GetUserByID(ctx, strconv.FormatUint(uint64(req.Id), 10))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &userv1.UserExistsResponse{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch user", err)
+	}
+	return &userv1.UserExistsResponse{Exists: user.AnonymizedAt == nil}, nil
+}
+
+// WatchUsers streams the user events until the client goes away or falls behind
+func (s *UserServer) WatchUsers(req *userv1.WatchUsersRequest, stream userv1.UserService_WatchUsersServer) error {
+	ctx := stream.Context()
+	w := s.Hub.watch(ctx, req.Ids)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.dropped:
+			return status.Error(codes.ResourceExhausted, "watcher fell behind, call WatchUsers again")
+		case event := <-w.ch:
+			if err := stream.Send(&userv1.WatchUsersResponse{Event: event}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// canViewPII reports whether the caller may see unmasked CPF, email and phone number
+func canViewPII(ctx context.Context) bool {
+	return PrincipalFromContext(ctx).HasRole(middleware.PIIRoles()...)
+}
+
+// internalError logs the cause of err and returns an INTERNAL status carrying only message. When the
+// call was cancelled or ran past its deadline the matching status is returned instead.
+func internalError(ctx context.Context, message string, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	slog.ErrorContext(ctx, message, "request_id", logging.RequestIDFromContext(ctx), "cause", apierror.RootCause(err).Error())
+	return status.Error(codes.Internal, message)
+}
+
+// newUser converts a user to its protobuf message, masking PII unless full is true
+func newUser(user *models.User, full bool) *userv1.User {
+	response := models.NewUserResponse(user, full)
+	return &userv1.User{
+		Id:           uint32(response.ID),
+		Name:         response.Name,
+		Cpf:          response.CPF,
+		Email:        response.Email,
+		PhoneNumber:  response.PhoneNumber,
+		CreatedAt:    timestamppb.New(response.CreatedAt),
+		UpdatedAt:    timestamp(response.UpdatedAt),
+		AnonymizedAt: timestamp(response.AnonymizedAt),
+	}
+}
+
+func newUserEvent(id string, eventType userv1.UserEventType, userID uint, occurredAt time.Time) *userv1.UserEvent {
+	return &userv1.UserEvent{Id: id, Type: eventType, UserId: uint32(userID), OccurredAt: timestamppb.New(occurredAt)}
+}
+
+// timestamp converts an optional time, leaving the field unset when t is nil
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// NewServer returns a gRPC server with the UserService, tracing and the auth interceptors registered
+func NewServer(server *UserServer) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(StreamInterceptor()),
+	)
+	userv1.RegisterUserServiceServer(s, server)
+	return s
+}
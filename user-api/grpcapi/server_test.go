@@ -0,0 +1,101 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"shared/audit"
+	"shared/database/databasetest"
+	"shared/logging"
+	"shared/middleware"
+	"shared/outbox"
+	"strings"
+	"testing"
+	"time"
+	"user-api/models"
+	"user-api/utils"
+
+	userv1 "user-api/gen/user/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a server on an in-memory database holding one user
+func newTestServer(t *testing.T) (*UserServer, models.User) {
+	db := databasetest.Open(t, &models.User{}, &outbox.Event{}, &audit.Log{})
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, utils.InitPII(key, "index-key"))
+
+	server := &UserServer{DB: db, Hub: NewHub(10), MaxBatch: 2}
+	user := models.User{Name: "John", CPF: "529.982.247-25", Email: "john@example.com", PhoneNumber: "11912345678"}
+	require.NoError(t, server.service().CreateUser(context.Background(), &user))
+	return server, user
+}
+
+func TestBatchGetUsersValidatesIDs(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	_, err := server.BatchGetUsers(context.Background(), &userv1.BatchGetUsersRequest{Ids: []uint32{1, 0}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.BatchGetUsers(context.Background(), &userv1.BatchGetUsersRequest{Ids: []uint32{1, 2, 3}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	response, err := server.BatchGetUsers(context.Background(), &userv1.BatchGetUsersRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, response.Users)
+}
+
+func TestBatchGetUsersMasksPIIByRole(t *testing.T) {
+	server, user := newTestServer(t)
+	request := &userv1.BatchGetUsersRequest{Ids: []uint32{uint32(user.ID), uint32(user.ID), 99}}
+
+	response, err := server.BatchGetUsers(context.Background(), request)
+	require.NoError(t, err)
+	require.Len(t, response.Users, 1)
+	assert.Equal(t, uint32(user.ID), response.Users[0].Id)
+	assert.NotEqual(t, "john@example.com", response.Users[0].Email)
+	assert.Contains(t, response.Users[0].Email, "*")
+
+	admin := context.WithValue(context.Background(), principalKey{}, middleware.Principal{Name: "ops", Role: "admin"})
+	response, err = server.BatchGetUsers(admin, request)
+	require.NoError(t, err)
+	require.Len(t, response.Users, 1)
+	assert.Equal(t, "john@example.com", response.Users[0].Email)
+}
+
+func TestUserExists(t *testing.T) {
+	server, user := newTestServer(t)
+
+	erased := models.User{Name: "Jane", CPF: "111.444.777-35", Email: "jane@example.com", PhoneNumber: "11987654321"}
+	require.NoError(t, server.service().CreateUser(context.Background(), &erased))
+	require.NoError(t, server.DB.Model(&erased).Update("anonymized_at", time.Now()).Error)
+
+	for id, exists := range map[uint32]bool{uint32(user.ID): true, uint32(erased.ID): false, 99: false, 0: false} {
+		response, err := server.UserExists(context.Background(), &userv1.UserExistsRequest{Id: id})
+		require.NoError(t, err)
+		assert.Equal(t, exists, response.Exists, "id %d", id)
+	}
+}
+
+func TestAuthenticateResolvesAPIKeys(t *testing.T) {
+	keys := map[string]middleware.Principal{"secret": {Name: "ops", Role: "admin"}}
+
+	_, principal, err := authenticate(context.Background(), keys)
+	require.NoError(t, err)
+	assert.Equal(t, middleware.Anonymous, principal)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "wrong"))
+	_, _, err = authenticate(ctx, keys)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "secret", "x-request-id", "req-1"))
+	ctx, principal, err = authenticate(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, "ops", principal.Name)
+	assert.Equal(t, principal, PrincipalFromContext(ctx))
+	assert.Equal(t, "req-1", logging.RequestIDFromContext(ctx))
+}
@@ -0,0 +1,85 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"shared/events"
+	"sync"
+
+	userv1 "user-api/gen/user/v1"
+)
+
+// watcher is a WatchUsers call: it receives the events about ids (every user when empty) on ch
+type watcher struct {
+	ids     map[uint32]bool
+	ch      chan *userv1.UserEvent
+	dropped chan struct{}
+}
+
+// Hub fans the user events out to the WatchUsers calls. It is fed by a single broker tail and never
+// blocks it: a watcher whose buffer is full is dropped and must call again.
+type Hub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	buffer   int
+}
+
+// NewHub returns a hub giving each watcher a buffer of buffer events
+func NewHub(buffer int) *Hub {
+	return &Hub{watchers: make(map[*watcher]struct{}), buffer: buffer}
+}
+
+// HandleUserEvent delivers a user event to the watchers interested in it; it is meant to be
+// registered as a broker handler
+func (h *Hub) HandleUserEvent(ctx context.Context, event events.Event) error {
+	eventType, ok := eventTypes[event.Type]
+	if !ok {
+		return nil
+	}
+	var data events.UserData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return nil
+	}
+	message := newUserEvent(event.ID, eventType, data.ID, event.OccurredAt)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if len(w.ids) > 0 && !w.ids[message.UserId] {
+			continue
+		}
+		select {
+		case w.ch <- message:
+		default:
+			delete(h.watchers, w)
+			close(w.dropped)
+		}
+	}
+	return nil
+}
+
+// watch registers a watcher for ids until ctx is done
+func (h *Hub) watch(ctx context.Context, ids []uint32) *watcher {
+	w := &watcher{ids: make(map[uint32]bool, len(ids)), ch: make(chan *userv1.UserEvent, h.buffer), dropped: make(chan struct{})}
+	for _, id := range ids {
+		w.ids[id] = true
+	}
+
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.watchers, w)
+		h.mu.Unlock()
+	}()
+	return w
+}
+
+var eventTypes = map[string]userv1.UserEventType{
+	events.UserCreated: userv1.UserEventType_USER_EVENT_TYPE_CREATED,
+	events.UserUpdated: userv1.UserEventType_USER_EVENT_TYPE_UPDATED,
+	events.UserDeleted: userv1.UserEventType_USER_EVENT_TYPE_DELETED,
+}
@@ -0,0 +1,73 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"shared/events"
+	"testing"
+	"time"
+
+	userv1 "user-api/gen/user/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func userEvent(t *testing.T, eventType string, id uint) events.Event {
+	data, err := json.Marshal(events.UserData{ID: id})
+	require.NoError(t, err)
+	return events.Event{ID: events.NewID(), Type: eventType, AggregateType: "user", OccurredAt: time.Now(), Data: data}
+}
+
+func TestHubDeliversEventsToInterestedWatchers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := NewHub(10)
+	all := hub.watch(ctx, nil)
+	one := hub.watch(ctx, []uint32{1})
+
+	require.NoError(t, hub.HandleUserEvent(ctx, userEvent(t, events.UserCreated, 1)))
+	require.NoError(t, hub.HandleUserEvent(ctx, userEvent(t, events.UserDeleted, 2)))
+	require.NoError(t, hub.HandleUserEvent(ctx, userEvent(t, events.OrderCreated, 1)))
+
+	require.Len(t, all.ch, 2)
+	assert.Equal(t, uint32(1), (<-all.ch).UserId)
+	deleted := <-all.ch
+	assert.Equal(t, uint32(2), deleted.UserId)
+	assert.Equal(t, userv1.UserEventType_USER_EVENT_TYPE_DELETED, deleted.Type)
+
+	require.Len(t, one.ch, 1)
+	assert.Equal(t, userv1.UserEventType_USER_EVENT_TYPE_CREATED, (<-one.ch).Type)
+}
+
+func TestHubDropsWatchersThatFallBehind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := NewHub(1)
+	w := hub.watch(ctx, nil)
+
+	require.NoError(t, hub.HandleUserEvent(ctx, userEvent(t, events.UserUpdated, 1)))
+	require.NoError(t, hub.HandleUserEvent(ctx, userEvent(t, events.UserUpdated, 1)))
+
+	select {
+	case <-w.dropped:
+	default:
+		t.Fatal("watcher with a full buffer was not dropped")
+	}
+	hub.mu.Lock()
+	assert.Empty(t, hub.watchers)
+	hub.mu.Unlock()
+}
+
+func TestHubForgetsWatchersWhenTheCallEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := NewHub(10)
+	hub.watch(ctx, nil)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.watchers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
-	"user-api/models"
+	"context"
+	"log/slog"
+	"net"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
+	"shared/config"
+	"shared/database"
+	"shared/events"
+	"shared/logging"
+	"shared/middleware"
+	"shared/outbox"
+	"shared/server"
+	"shared/tracing"
+	"time"
+	"user-api/grpcapi"
 	"user-api/routes"
+	"user-api/services"
+	"user-api/utils"
 
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
 	_ "user-api/docs"
-
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 // @title User API
@@ -25,18 +38,118 @@ import (
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 // @host localhost:8081
 // @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
+	slog.SetDefault(logging.NewLogger())
+
+	shutdownTracing, err := tracing.Init(context.Background(), "user-api", config.GetEnv("OTEL_TRACES_EXPORTER", "none"))
+	if err != nil {
+		panic("failed to configure tracing: " + err.Error())
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := utils.InitPII(config.GetEnv("PII_ENCRYPTION_KEY", ""), config.GetEnv("PII_BLIND_INDEX_KEY", "")); err != nil {
+		panic("failed to configure PII encryption: " + err.Error())
+	}
+
 	dsn := "host=postgres user=user password=password dbname=userdb port=5432 sslmode=disable TimeZone=America/Sao_Paulo"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := database.Open(database.ConfigFromEnv(dsn, "userdb"))
+	if err != nil {
+		panic(err.Error() + ": " + apierror.RootCause(err).Error())
+	}
+
+	userService := services.UserService{DB: db}
+	if err := userService.Migrate(); err != nil {
+		panic("failed to migrate users: " + err.Error())
+	}
+
+	auditService := audit.Service{DB: db}
+	if err := auditService.Migrate(); err != nil {
+		panic("failed to migrate audit log: " + err.Error())
+	}
+
+	db.AutoMigrate(&outbox.Event{})
+	userEvents := newEventBroker()
+	relay := outbox.Relay{
+		DB:           db,
+		Broker:       userEvents,
+		PollInterval: config.GetEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    100,
+		Retention:    config.GetEnvDuration("OUTBOX_RETENTION", 24*time.Hour),
+	}
+	go relay.Run(context.Background())
+
+	if err := userService.ProtectLegacyPII(); err != nil {
+		panic("failed to protect legacy PII: " + err.Error())
+	}
+
+	r := server.New("user-api")
+
+	timeouts, err := middleware.ParseRouteTimeouts(config.GetEnv("REQUEST_TIMEOUTS", "GET /users/export=0,default=10s"))
 	if err != nil {
-		panic("failed to connect database" + err.Error())
+		panic("invalid request timeouts: " + err.Error())
 	}
+	r.Use(middleware.Timeout(timeouts))
+
+	userCache := newCache()
+	routes.UserRoutes(r, db, userCache)
+	routes.AuditRoutes(r, db)
+
+	go serveGRPC(db, userCache, userEvents)
+	server.Run(r, ":8081")
+}
 
-	db.AutoMigrate(&models.User{})
+// serveGRPC serves the gRPC UserService on GRPC_ADDR. WatchUsers is fed by tailing the user events,
+// so every instance sees every event without a consumer group of its own.
+func serveGRPC(db *gorm.DB, userCache cache.Cache, userEvents events.Tailer) {
+	hub := grpcapi.NewHub(config.GetEnvInt("USER_WATCH_BUFFER", 100))
+	go func() {
+		for {
+			err := userEvents.Tail(context.Background(), hub.HandleUserEvent)
+			slog.Error("user watch subscription stopped, retrying", "error", err.Error())
+			time.Sleep(5 * time.Second)
+		}
+	}()
 
-	r := gin.Default()
-	routes.UserRoutes(r, db)
+	listener, err := net.Listen("tcp", config.GetEnv("GRPC_ADDR", ":9081"))
+	if err != nil {
+		panic("failed to listen for gRPC: " + err.Error())
+	}
+	grpcServer := grpcapi.NewServer(&grpcapi.UserServer{
+		DB:       db,
+		Cache:    userCache,
+		Hub:      hub,
+		MaxBatch: config.GetEnvInt("USER_LOOKUP_MAX_IDS", 100),
+	})
+	if err := grpcServer.Serve(listener); err != nil {
+		panic("gRPC server stopped: " + err.Error())
+	}
+}
+
+// eventBroker carries the user events: published through the outbox and tailed by WatchUsers
+type eventBroker interface {
+	events.Broker
+	events.Tailer
+}
+
+// newEventBroker returns the broker selected by EVENT_BROKER ("memory" or "redis")
+func newEventBroker() eventBroker {
+	if config.GetEnv("EVENT_BROKER", "memory") == "redis" {
+		return events.NewRedisStreamBroker(newRedisClient(), config.GetEnv("USER_EVENTS_STREAM", "user-events"))
+	}
+	return events.NewMemoryBroker()
+}
+
+// newCache returns the cache selected by CACHE_STORE ("memory" or "redis"); entries stored in Redis are encrypted
+func newCache() cache.Cache {
+	if config.GetEnv("CACHE_STORE", "memory") == "redis" {
+		return cache.NewEncryptedCache(cache.NewRedisCache(newRedisClient(), "cache:"), utils.EncryptPII, utils.DecryptPII)
+	}
+	return cache.NewMemoryCache()
+}
 
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	r.Run(":8081")
+func newRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: config.GetEnv("REDIS_ADDR", "redis:6379")})
 }
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"shared/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PIIRoles returns the roles allowed to see unmasked CPF, email and phone number (PII_AUTHORIZED_ROLES)
+func PIIRoles() []string {
+	return middleware.RolesFromEnv("PII_AUTHORIZED_ROLES")
+}
+
+// CanViewPII reports whether the caller may see unmasked CPF, email and phone number
+func CanViewPII(c *gin.Context) bool {
+	return middleware.HasRole(c, PIIRoles()...)
+}
@@ -1,5 +0,0 @@
-package models
-
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DataExport reúne todos os dados de um titular para atender requisições da LGPD
+type DataExport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	User        UserResponse      `json:"user"`
+	Orders      []json.RawMessage `json:"orders" swaggertype:"array,object"`
+}
+
+// ErasureResult resume a anonimização de um titular
+type ErasureResult struct {
+	UserID              uint      `json:"user_id"`
+	AnonymizedAt        time.Time `json:"anonymized_at"`
+	OrdersPseudonymized int64     `json:"orders_pseudonymized"`
+}
@@ -1,17 +1,23 @@
 package models
 
 import (
+	"shared/pii"
 	"time"
 )
 
 type User struct {
 	ID          uint       `json:"id" gorm:"primaryKey;autoIncrement"`
 	Name        string     `json:"name" validate:"required"`
-	CPF         string     `json:"cpf" validate:"required,cpf"`
+	CPF         string     `json:"cpf" validate:"required,cpf" gorm:"serializer:pii"`
+	CPFHash     *string    `json:"-" gorm:"uniqueIndex"`
 	Email       string     `json:"email" validate:"required,email"`
-	PhoneNumber string     `json:"phone_number" validate:"required"`
+	PhoneNumber string     `json:"phone_number" validate:"required" gorm:"serializer:pii"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   *time.Time `json:"updated_at,omitempty" gorm:"default:null"`
+	// AnonymizedAt is set when the user's personal data has been erased
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty" gorm:"default:null"`
+	// PhoneHash is the blind index of the normalized phone number, used for lookups
+	PhoneHash *string `json:"-" gorm:"index"`
 }
 
 type UserRequest struct {
@@ -20,3 +26,80 @@ type UserRequest struct {
 	Email       string `json:"email" validate:"required,email"`
 	PhoneNumber string `json:"phone_number" validate:"required"`
 }
+
+// UserResponse é a representação pública de um usuário, com CPF, email e telefone mascarados por padrão
+type UserResponse struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	CPF          string     `json:"cpf"`
+	Email        string     `json:"email"`
+	PhoneNumber  string     `json:"phone_number"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+}
+
+// NewUserResponse builds the response for a user, masking PII unless full is true
+func NewUserResponse(user *User, full bool) UserResponse {
+	response := UserResponse{
+		ID:           user.ID,
+		Name:         user.Name,
+		CPF:          user.CPF,
+		Email:        user.Email,
+		PhoneNumber:  user.PhoneNumber,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		AnonymizedAt: user.AnonymizedAt,
+	}
+	if !full {
+		response.CPF = pii.MaskCPF(user.CPF)
+		response.Email = pii.MaskEmail(user.Email)
+		response.PhoneNumber = pii.MaskPhone(user.PhoneNumber)
+	}
+	return response
+}
+
+// NewUserResponses builds the responses for a list of users
+func NewUserResponses(users []User, full bool) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, NewUserResponse(&users[i], full))
+	}
+	return responses
+}
+
+// UserSearchQuery combines the criteria of a user search; every criterion given must match
+type UserSearchQuery struct {
+	Name  string
+	Email string
+	Phone string
+	CPF   string
+	Limit int
+}
+
+// UserExportFilter selects the users of an export; every filter given must match
+type UserExportFilter struct {
+	Name  string
+	Email string
+	Phone string
+	CPF   string
+	From  *time.Time
+	To    *time.Time
+}
+
+// BatchUserResult é o resultado da criação de um usuário do lote; Status é o código HTTP que a criação
+// isolada teria retornado e User só é preenchido quando o usuário foi criado
+type BatchUserResult struct {
+	Index  int           `json:"index"`
+	Status int           `json:"status"`
+	User   *UserResponse `json:"user,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// BatchUserResponse resume a criação de usuários em lote
+type BatchUserResponse struct {
+	Mode    string            `json:"mode"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchUserResult `json:"results"`
+}
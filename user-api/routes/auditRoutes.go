@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"user-api/controllers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func AuditRoutes(r *gin.Engine, db *gorm.DB) {
+	r.GET("/audit", controllers.GetAuditLogs(db))
+}
@@ -1,16 +1,22 @@
 package routes
 
 import (
+	"shared/cache"
 	"user-api/controllers"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func UserRoutes(r *gin.Engine, db *gorm.DB) {
+func UserRoutes(r *gin.Engine, db *gorm.DB, userCache cache.Cache) {
 	r.GET("/users", controllers.GetUsers(db))
-	r.GET("/users/:id", controllers.GetUserByID(db))
+	r.GET("/users/search", controllers.SearchUsers(db))
+	r.GET("/users/export", controllers.ExportUsers(db))
+	r.GET("/users/:id", controllers.GetUserByID(db, userCache))
 	r.POST("/users", controllers.CreateUser(db))
-	r.PUT("/users/:id", controllers.UpdateUser(db))
-	r.DELETE("/users/:id", controllers.DeleteUser(db))
+	r.POST("/users/batch", controllers.CreateUsers(db))
+	r.PUT("/users/:id", controllers.UpdateUser(db, userCache))
+	r.DELETE("/users/:id", controllers.DeleteUser(db, userCache))
+	r.GET("/users/:id/data-export", controllers.ExportUserData(db, userCache))
+	r.POST("/users/:id/erasure", controllers.EraseUser(db, userCache))
 }
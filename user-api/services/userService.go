@@ -1,86 +1,459 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"shared/apierror"
+	"shared/audit"
+	"shared/cache"
+	"shared/config"
+	"shared/events"
+	"shared/export"
+	"shared/outbox"
+	"shared/validation"
+	"strconv"
 	"strings"
+	"time"
 	"user-api/models"
 	"user-api/utils"
 
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-var validate *validator.Validate
-var cpf string
+var validate = validation.New()
+
+// ErrOrderAPI indicates that a call to the order-api failed
+var ErrOrderAPI = errors.New("order-api request failed")
+
+// ErrInvalidSearch indicates that a search criterion is malformed
+var ErrInvalidSearch = errors.New("invalid search criteria")
 
 func init() {
-	validate = validator.New()
 	validate.RegisterValidation("cpf", func(fl validator.FieldLevel) bool {
-		valid, cpfFormat := utils.IsValidCPF(fl.Field().String())
-		cpf = cpfFormat
+		valid, _ := utils.IsValidCPF(fl.Field().String())
 		return valid
 	})
 }
 
+// userCacheTTL is how long GetUserByID results stay cached
+var userCacheTTL = config.GetEnvDuration("USER_CACHE_TTL", 5*time.Minute)
+
 type UserService struct {
 	DB *gorm.DB
+	// Audit identifies the actor and request recorded in the audit log for write operations
+	Audit audit.Metadata
+	// Cache holds GetUserByID results; writes invalidate the users they change. Nil disables caching.
+	Cache cache.Cache
+}
+
+// userCacheKey returns the cache key of a user
+func userCacheKey(id uint) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+// phoneHash returns the blind index of a phone number, or nil when there is none
+func phoneHash(phone string) *string {
+	normalized := utils.NormalizePhone(phone)
+	if normalized == "" {
+		return nil
+	}
+	hash := utils.BlindIndex(normalized)
+	return &hash
+}
+
+// auditUser is the representation of a user compared for the audit log. Users are audited with
+// audit.RecordFields, so only the names of the changed fields are stored, never their values.
+func auditUser(user *models.User) interface{} {
+	if user == nil {
+		return nil
+	}
+	return models.NewUserResponse(user, true)
 }
 
-func (s *UserService) GetAllUsers() ([]models.User, error) {
+func (s *UserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	if err := s.DB.Find(&users).Error; err != nil {
+	if err := s.DB.WithContext(ctx).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersByIDs loads the given users in one query, ordered by ID; IDs without a user are skipped
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	var users []models.User
+	if err := s.DB.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		return nil, apierror.Wrap("failed to fetch users", err)
+	}
+	return users, nil
+}
+
+// trigramSearch is set by Migrate when the pg_trgm extension is available; without it SearchUsers
+// matches names by substring only
+var trigramSearch bool
+
+// Migrate creates the users table and the indexes used by SearchUsers: an index on the lowercased
+// email and, when the pg_trgm extension can be used, a trigram index for fuzzy name matching.
+// Creating the extension needs privileges the database user may not have, so failing to is only logged.
+func (s *UserService) Migrate() error {
+	if err := s.DB.AutoMigrate(&models.User{}); err != nil {
+		return err
+	}
+	if err := s.DB.Exec("CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email))").Error; err != nil {
+		return err
+	}
+
+	err := s.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+	if err == nil {
+		err = s.DB.Exec("CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops)").Error
+	}
+	if err != nil {
+		slog.Warn("pg_trgm is unavailable, user names are searched by substring only", "error", err.Error())
+		return nil
+	}
+	trigramSearch = true
+	return nil
+}
+
+// SearchUsers finds users matching every given criterion. Names match partially or, with pg_trgm, by
+// trigram similarity, best matches first; email matches exactly, ignoring case; phone and CPF match in any formatting through
+// their blind indexes. Anonymized users are never returned.
+func (s *UserService) SearchUsers(ctx context.Context, query models.UserSearchQuery) ([]models.User, error) {
+	db := s.DB.WithContext(ctx).Where("anonymized_at IS NULL")
+	order := clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "id"}}}}
+	switch {
+	case query.Name != "" && trigramSearch:
+		db = db.Where("name ILIKE ? OR name % ?", "%"+escapeLike(query.Name)+"%", query.Name)
+		order = clause.OrderBy{Expression: clause.Expr{SQL: "similarity(name, ?) DESC, id", Vars: []interface{}{query.Name}, WithoutParentheses: true}}
+	case query.Name != "":
+		db = db.Where("name ILIKE ?", "%"+escapeLike(query.Name)+"%")
+	}
+	db, err := filterUserContacts(db, query.Email, query.Phone, query.CPF)
+	if err != nil {
 		return nil, err
 	}
+
+	var users []models.User
+	if err := db.Clauses(order).Limit(query.Limit).Find(&users).Error; err != nil {
+		return nil, apierror.Wrap("failed to search users", err)
+	}
 	return users, nil
 }
 
-func (s *UserService) GetUserByID(id string) (*models.User, error) {
+// filterUserContacts restricts db to the users with the given email, phone number and CPF; empty
+// values are ignored. Phone and CPF match in any formatting through their blind indexes.
+func filterUserContacts(db *gorm.DB, email, phone, cpf string) (*gorm.DB, error) {
+	if email != "" {
+		db = db.Where("lower(email) = lower(?)", email)
+	}
+	if phone != "" {
+		hash := phoneHash(phone)
+		if hash == nil {
+			return nil, apierror.Wrap("invalid phone number", ErrInvalidSearch)
+		}
+		db = db.Where("phone_hash = ?", *hash)
+	}
+	if cpf != "" {
+		valid, cpfDigits := utils.IsValidCPF(cpf)
+		if !valid {
+			return nil, apierror.Wrap("invalid CPF", ErrInvalidSearch)
+		}
+		db = db.Where("cpf_hash = ?", utils.BlindIndex(cpfDigits))
+	}
+	return db, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// UserExportColumns are the columns a user export can select, in their default order
+var UserExportColumns = []string{"id", "name", "cpf", "email", "phone_number", "created_at", "updated_at", "anonymized_at"}
+
+// userExportValue returns the value of a user export column
+func userExportValue(user *models.UserResponse, column string) interface{} {
+	switch column {
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "cpf":
+		return user.CPF
+	case "email":
+		return user.Email
+	case "phone_number":
+		return user.PhoneNumber
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	case "anonymized_at":
+		return user.AnonymizedAt
+	default:
+		return nil
+	}
+}
+
+// ExportUsers writes the users matching filter to w in ID order, masking PII unless full is true.
+// Rows are read one at a time from a database cursor, so memory use does not grow with the number of users.
+func (s *UserService) ExportUsers(ctx context.Context, filter models.UserExportFilter, columns []string, full bool, w export.Writer) error {
+	db := s.DB.WithContext(ctx).Model(&models.User{})
+	if filter.Name != "" {
+		db = db.Where("name ILIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.From != nil {
+		db = db.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		db = db.Where("created_at < ?", *filter.To)
+	}
+	db, err := filterUserContacts(db, filter.Email, filter.Phone, filter.CPF)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Select(columns).Order("id").Rows()
+	if err != nil {
+		return apierror.Wrap("failed to export users", err)
+	}
+	defer rows.Close()
+
+	if err := w.WriteHeader(columns); err != nil {
+		return apierror.Wrap("failed to export users", err)
+	}
+	values := make([]interface{}, len(columns))
+	for rows.Next() {
+		var user models.User
+		if err := s.DB.ScanRows(rows, &user); err != nil {
+			return apierror.Wrap("failed to export users", err)
+		}
+		response := models.NewUserResponse(&user, full)
+		for i, column := range columns {
+			values[i] = userExportValue(&response, column)
+		}
+		if err := w.WriteRow(values); err != nil {
+			return apierror.Wrap("failed to export users", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return apierror.Wrap("failed to export users", err)
+	}
+	return w.Close()
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return s.loadUser(ctx, id)
+	}
+	return cache.GetOrLoad(ctx, s.Cache, userCacheKey(uint(userID)), userCacheTTL, func(ctx context.Context) (*models.User, error) {
+		return s.loadUser(ctx, id)
+	})
+}
+
+func (s *UserService) loadUser(ctx context.Context, id string) (*models.User, error) {
 	var user models.User
-	if err := s.DB.First(&user, id).Error; err != nil {
+	if err := s.DB.WithContext(ctx).First(&user, id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *UserService) CreateUser(user *models.User) error {
+// prepareUser validates a new user and stores its CPF as digits along with the blind indexes
+func prepareUser(user *models.User) error {
 	if err := validate.Struct(user); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		errorMessages := make(map[string]string)
-		for _, err := range validationErrors {
-			errorMessages[err.Field()] = err.Tag()
-		}
-		var sb strings.Builder
-		for field, tag := range errorMessages {
-			sb.WriteString(fmt.Sprintf("%s: %s, ", field, tag))
-		}
-		errorMsg := strings.TrimRight(sb.String(), ", ")
-		return errors.New(errorMsg)
+		return validation.Error(err)
 	}
 
-	user.CPF = cpf
+	_, cpfDigits := utils.IsValidCPF(user.CPF)
+	user.CPF = cpfDigits
+	cpfHash := utils.BlindIndex(user.CPF)
+	user.CPFHash = &cpfHash
+	user.PhoneHash = phoneHash(user.PhoneNumber)
+	return nil
+}
+
+// enqueueUserEvent writes a domain event about user into the outbox using tx,
+// so the event is stored if and only if the change is committed.
+// The payload carries no personal data, only what consumers need to track the user's existence.
+func enqueueUserEvent(tx *gorm.DB, eventType string, user *models.User) error {
+	return outbox.Enqueue(tx, eventType, "user", user.ID, events.UserData{ID: user.ID, Anonymized: user.AnonymizedAt != nil})
+}
+
+// insertUser creates the user with its event and audit entry using tx
+func (s *UserService) insertUser(tx *gorm.DB, user *models.User) error {
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	if err := enqueueUserEvent(tx, events.UserCreated, user); err != nil {
+		return err
+	}
+	return audit.RecordFields(tx, s.Audit, "create", "user", user.ID, nil, auditUser(user))
+}
+
+func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+	db := s.DB.WithContext(ctx)
+	if err := prepareUser(user); err != nil {
+		return err
+	}
 
 	var existingUser models.User
-	if err := s.DB.Where("cpf = ?", user.CPF).First(&existingUser).Error; err != nil {
+	if err := db.Where("cpf_hash = ?", *user.CPFHash).First(&existingUser).Error; err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("error when checking CPF")
+			return apierror.Wrap("error when checking CPF", err)
 		}
 	} else {
 		return errors.New("CPF already registered")
 	}
 
-	if err := s.DB.Create(user).Error; err != nil {
-		return errors.New("failed to create user")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return s.insertUser(tx, user)
+	})
+	if err != nil {
+		return apierror.Wrap("failed to create user", err)
 	}
 
 	return nil
 }
 
-func (s *UserService) UpdateUser(id string, user *models.User) (*models.User, error) {
+// CreateUsers creates a batch of users and returns one result per user, in order. Duplicated CPFs and
+// emails (ignoring case) are rejected both within the batch and against existing users; a CPF registered
+// concurrently, caught by its unique index, is reported as a conflict too. In atomic mode no user is
+// created unless all of them are valid, and they are created in a single transaction; otherwise every
+// valid user is created on its own.
+func (s *UserService) CreateUsers(ctx context.Context, users []models.User, atomic bool) []models.BatchUserResult {
+	db := s.DB.WithContext(ctx)
+	results := make([]models.BatchUserResult, len(users))
+	firstByCPF := make(map[string]int)
+	firstByEmail := make(map[string]int)
+	var hashes, emails []string
+	for i := range users {
+		results[i] = models.BatchUserResult{Index: i}
+		if err := prepareUser(&users[i]); err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			continue
+		}
+		hash := *users[i].CPFHash
+		if first, ok := firstByCPF[hash]; ok {
+			results[i].Status = http.StatusConflict
+			results[i].Error = fmt.Sprintf("CPF duplicated in batch (item %d)", first)
+			continue
+		}
+		email := strings.ToLower(users[i].Email)
+		if first, ok := firstByEmail[email]; ok {
+			results[i].Status = http.StatusConflict
+			results[i].Error = fmt.Sprintf("email duplicated in batch (item %d)", first)
+			continue
+		}
+		firstByCPF[hash] = i
+		firstByEmail[email] = i
+		hashes = append(hashes, hash)
+		emails = append(emails, email)
+	}
+
+	var registeredCPFs, registeredEmails []string
+	if len(hashes) > 0 {
+		err := db.Model(&models.User{}).Where("cpf_hash IN ?", hashes).Pluck("cpf_hash", &registeredCPFs).Error
+		if err == nil {
+			err = db.Model(&models.User{}).Where("lower(email) IN ?", emails).Pluck("lower(email)", &registeredEmails).Error
+		}
+		if err != nil {
+			slog.Error("failed to check user batch for duplicates", "error", err.Error())
+			for i := range results {
+				if results[i].Status == 0 {
+					results[i].Status = http.StatusInternalServerError
+					results[i].Error = "error when checking CPF and email"
+				}
+			}
+			return results
+		}
+	}
+	for _, hash := range registeredCPFs {
+		i := firstByCPF[hash]
+		results[i].Status = http.StatusConflict
+		results[i].Error = "CPF already registered"
+	}
+	for _, email := range registeredEmails {
+		if i, ok := firstByEmail[email]; ok && results[i].Status == 0 {
+			results[i].Status = http.StatusConflict
+			results[i].Error = "email already registered"
+		}
+	}
+
+	var valid []int
+	for i := range results {
+		if results[i].Status == 0 {
+			valid = append(valid, i)
+		}
+	}
+
+	if atomic {
+		status, message := http.StatusCreated, ""
+		if len(valid) < len(users) {
+			status, message = http.StatusFailedDependency, "not created: other users in the batch are invalid"
+		} else {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				for _, i := range valid {
+					if err := s.insertUser(tx, &users[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				slog.Error("failed to create user batch", "error", err.Error())
+				status, message = insertFailure(err)
+				if status == http.StatusConflict {
+					message = "not created: a CPF in the batch was registered by another request"
+				}
+			}
+		}
+		for _, i := range valid {
+			results[i].Status = status
+			results[i].Error = message
+		}
+		return results
+	}
+
+	for _, i := range valid {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return s.insertUser(tx, &users[i])
+		})
+		if err != nil {
+			slog.Error("failed to create user", "index", i, "error", err.Error())
+			results[i].Status, results[i].Error = insertFailure(err)
+			continue
+		}
+		results[i].Status = http.StatusCreated
+	}
+	return results
+}
+
+// insertFailure returns the batch result of a failed insert: a conflict when the CPF was registered by
+// a concurrent request after it was checked, an internal error otherwise
+func insertFailure(err error) (int, string) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return http.StatusConflict, "CPF already registered"
+	}
+	return http.StatusInternalServerError, "failed to create user"
+}
+
+func (s *UserService) UpdateUser(ctx context.Context, id string, user *models.User) (*models.User, error) {
+	db := s.DB.WithContext(ctx)
 	var existingUser models.User
-	if err := s.DB.First(&existingUser, id).Error; err != nil {
-		return nil, errors.New("user not found")
+	if err := db.First(&existingUser, id).Error; err != nil {
+		return nil, apierror.Wrap("user not found", err)
+	}
+	if existingUser.AnonymizedAt != nil {
+		return nil, errors.New("user has been anonymized")
 	}
+	before := existingUser
 
 	if user.Name != "" {
 		existingUser.Name = user.Name
@@ -90,25 +463,146 @@ func (s *UserService) UpdateUser(id string, user *models.User) (*models.User, er
 	}
 	if user.PhoneNumber != "" {
 		existingUser.PhoneNumber = user.PhoneNumber
+		existingUser.PhoneHash = phoneHash(user.PhoneNumber)
 	}
 	if user.CPF != "" {
-		existingUser.CPF = user.CPF
+		valid, cpfDigits := utils.IsValidCPF(user.CPF)
+		if !valid {
+			return nil, errors.New("CPF: cpf")
+		}
+		cpfHash := utils.BlindIndex(cpfDigits)
+		var otherUser models.User
+		if err := db.Where("cpf_hash = ? AND id <> ?", cpfHash, existingUser.ID).First(&otherUser).Error; err == nil {
+			return nil, errors.New("CPF already registered")
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apierror.Wrap("error when checking CPF", err)
+		}
+		existingUser.CPF = cpfDigits
+		existingUser.CPFHash = &cpfHash
 	}
 
 	if err := validate.Struct(existingUser); err != nil {
 		return nil, err
 	}
 
-	if err := s.DB.Save(&existingUser).Error; err != nil {
-		return nil, errors.New("failed to update user")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingUser).Error; err != nil {
+			return err
+		}
+		if err := enqueueUserEvent(tx, events.UserUpdated, &existingUser); err != nil {
+			return err
+		}
+		return audit.RecordFields(tx, s.Audit, "update", "user", existingUser.ID, auditUser(&before), auditUser(&existingUser))
+	})
+	if err != nil {
+		return nil, apierror.Wrap("failed to update user", err)
 	}
+	cache.Invalidate(context.WithoutCancel(ctx), s.Cache, userCacheKey(existingUser.ID))
 
 	return &existingUser, nil
 }
 
-func (s *UserService) DeleteUser(id string) error {
-	if err := s.DB.Delete(&models.User{}, id).Error; err != nil {
-		return errors.New("user not found")
+func (s *UserService) DeleteUser(ctx context.Context, id string) error {
+	db := s.DB.WithContext(ctx)
+	var existingUser models.User
+	if err := db.First(&existingUser, id).Error; err != nil {
+		return apierror.Wrap("user not found", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&existingUser).Error; err != nil {
+			return err
+		}
+		if err := enqueueUserEvent(tx, events.UserDeleted, &existingUser); err != nil {
+			return err
+		}
+		return audit.RecordFields(tx, s.Audit, "delete", "user", existingUser.ID, auditUser(&existingUser), nil)
+	})
+	if err != nil {
+		return apierror.Wrap("failed to delete user", err)
+	}
+	cache.Invalidate(context.WithoutCancel(ctx), s.Cache, userCacheKey(existingUser.ID))
+	return nil
+}
+
+// ProtectLegacyPII encrypts CPF and phone number of users stored before PII encryption and fills their blind indexes.
+// Anonymized users have no CPF or phone number and are skipped.
+func (s *UserService) ProtectLegacyPII() error {
+	var users []models.User
+	if err := s.DB.Where("(cpf_hash IS NULL OR phone_hash IS NULL) AND anonymized_at IS NULL").Find(&users).Error; err != nil {
+		return err
+	}
+	for i := range users {
+		cpfHash := utils.BlindIndex(utils.OnlyDigits(users[i].CPF))
+		users[i].CPFHash = &cpfHash
+		users[i].PhoneHash = phoneHash(users[i].PhoneNumber)
+		if err := s.DB.Save(&users[i]).Error; err != nil {
+			return fmt.Errorf("failed to protect user %d: %w", users[i].ID, err)
+		}
 	}
 	return nil
 }
+
+// ExportUserData gathers the user record and all of the user's orders from the order-api
+func (s *UserService) ExportUserData(ctx context.Context, id string) (*models.DataExport, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := utils.GetUserOrders(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch user orders: %w", ErrOrderAPI, err)
+	}
+
+	return &models.DataExport{
+		GeneratedAt: time.Now(),
+		User:        models.NewUserResponse(user, true),
+		Orders:      orders,
+	}, nil
+}
+
+// EraseUser pseudonymizes the user's orders in the order-api and anonymizes the user record.
+// Running it again for an anonymized user only retries the order pseudonymization.
+func (s *UserService) EraseUser(ctx context.Context, id string) (*models.ErasureResult, error) {
+	user, err := s.loadUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ordersPseudonymized, err := utils.PseudonymizeUserOrders(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to pseudonymize user orders: %w", ErrOrderAPI, err)
+	}
+
+	if user.AnonymizedAt == nil {
+		before := *user
+		now := time.Now()
+		user.Name = "Anonymized User"
+		user.CPF = ""
+		user.CPFHash = nil
+		user.Email = fmt.Sprintf("anonymized-%d@anonymized.invalid", user.ID)
+		user.PhoneNumber = ""
+		user.PhoneHash = nil
+		user.AnonymizedAt = &now
+		err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(user).Error; err != nil {
+				return err
+			}
+			if err := enqueueUserEvent(tx, events.UserUpdated, user); err != nil {
+				return err
+			}
+			return audit.RecordFields(tx, s.Audit, "erase", "user", user.ID, auditUser(&before), auditUser(user))
+		})
+		if err != nil {
+			return nil, apierror.Wrap("failed to anonymize user", err)
+		}
+		cache.Invalidate(context.WithoutCancel(ctx), s.Cache, userCacheKey(user.ID))
+	}
+
+	return &models.ErasureResult{
+		UserID:              user.ID,
+		AnonymizedAt:        *user.AnonymizedAt,
+		OrdersPseudonymized: ordersPseudonymized,
+	}, nil
+}
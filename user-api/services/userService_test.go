@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"shared/audit"
+	"shared/database/databasetest"
+	"shared/outbox"
+	"strings"
+	"testing"
+	"user-api/models"
+	"user-api/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newDryRunService returns a service whose queries are built for Postgres but never run; the SQL and
+// variables of the last query are written to sql and vars
+func newDryRunService(t *testing.T, sql *string, vars *[]interface{}) *UserService {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+	db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		*sql = tx.Statement.SQL.String()
+		*vars = tx.Statement.Vars
+	})
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, utils.InitPII(key, "index-key"))
+	return &UserService{DB: db}
+}
+
+func TestSearchUsersByName(t *testing.T) {
+	var sql string
+	var vars []interface{}
+	service := newDryRunService(t, &sql, &vars)
+	defer func(enabled bool) { trigramSearch = enabled }(trigramSearch)
+
+	trigramSearch = true
+	_, err := service.SearchUsers(context.Background(), models.UserSearchQuery{Name: "50%_jo", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "users" WHERE anonymized_at IS NULL AND (name ILIKE $1 OR name % $2) ORDER BY similarity(name, $3) DESC, id LIMIT $4`, sql)
+	assert.Equal(t, []interface{}{`%50\%\_jo%`, "50%_jo", "50%_jo", 10}, vars)
+
+	trigramSearch = false
+	_, err = service.SearchUsers(context.Background(), models.UserSearchQuery{Name: "jo", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "users" WHERE anonymized_at IS NULL AND name ILIKE $1 ORDER BY "id" LIMIT $2`, sql)
+	assert.Equal(t, []interface{}{"%jo%", 10}, vars)
+}
+
+func TestSearchUsersByContacts(t *testing.T) {
+	var sql string
+	var vars []interface{}
+	service := newDryRunService(t, &sql, &vars)
+
+	_, err := service.SearchUsers(context.Background(), models.UserSearchQuery{
+		Email: "John@Example.com", Phone: "+55 (11) 91234-5678", CPF: "529.982.247-25", Limit: 5,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "users" WHERE anonymized_at IS NULL AND lower(email) = lower($1) AND phone_hash = $2 AND cpf_hash = $3 ORDER BY "id" LIMIT $4`, sql)
+	assert.Equal(t, []interface{}{"John@Example.com", utils.BlindIndex("11912345678"), utils.BlindIndex("52998224725"), 5}, vars)
+}
+
+func TestSearchUsersRejectsInvalidContacts(t *testing.T) {
+	var sql string
+	var vars []interface{}
+	service := newDryRunService(t, &sql, &vars)
+
+	_, err := service.SearchUsers(context.Background(), models.UserSearchQuery{Phone: "---", Limit: 5})
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+	assert.EqualError(t, err, "invalid phone number")
+
+	_, err = service.SearchUsers(context.Background(), models.UserSearchQuery{CPF: "111.111.111-11", Limit: 5})
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+	assert.EqualError(t, err, "invalid CPF")
+	assert.Empty(t, sql)
+}
+
+// newBatchTestService returns a service on an in-memory database
+func newBatchTestService(t *testing.T) *UserService {
+	db := databasetest.Open(t, &models.User{}, &outbox.Event{}, &audit.Log{})
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, utils.InitPII(key, "index-key"))
+	return &UserService{DB: db}
+}
+
+func batchUser(cpf, email string) models.User {
+	return models.User{Name: "John", CPF: cpf, Email: email, PhoneNumber: "11912345678"}
+}
+
+func batchStatuses(results []models.BatchUserResult) []int {
+	statuses := make([]int, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+func TestCreateUsersRejectsDuplicatedEmails(t *testing.T) {
+	service := newBatchTestService(t)
+	existing := batchUser("529.982.247-25", "taken@example.com")
+	require.NoError(t, service.CreateUser(context.Background(), &existing))
+
+	results := service.CreateUsers(context.Background(), []models.User{
+		batchUser("111.444.777-35", "john@example.com"),
+		batchUser("123.456.789-09", "John@Example.com"),
+		batchUser("935.411.347-80", "TAKEN@example.com"),
+	}, false)
+
+	assert.Equal(t, []int{http.StatusCreated, http.StatusConflict, http.StatusConflict}, batchStatuses(results))
+	assert.Equal(t, "email duplicated in batch (item 0)", results[1].Error)
+	assert.Equal(t, "email already registered", results[2].Error)
+
+	var count int64
+	service.DB.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestCreateUsersRejectsDuplicatedCPFs(t *testing.T) {
+	service := newBatchTestService(t)
+	existing := batchUser("529.982.247-25", "existing@example.com")
+	require.NoError(t, service.CreateUser(context.Background(), &existing))
+
+	results := service.CreateUsers(context.Background(), []models.User{
+		batchUser("111.444.777-35", "a@example.com"),
+		batchUser("111.444.777-35", "b@example.com"),
+		batchUser("52998224725", "c@example.com"),
+	}, true)
+
+	assert.Equal(t, []int{http.StatusFailedDependency, http.StatusConflict, http.StatusConflict}, batchStatuses(results))
+	assert.Equal(t, "CPF duplicated in batch (item 0)", results[1].Error)
+	assert.Equal(t, "CPF already registered", results[2].Error)
+}
+
+func TestCreateUsersReportsConcurrentCPFRegistrationAsConflict(t *testing.T) {
+	service := newBatchTestService(t)
+	// Another request registers the CPF between the duplicate check and the insert; the unique index
+	// rejects the insert, which the Postgres dialector translates to gorm.ErrDuplicatedKey
+	require.NoError(t, service.DB.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if user, ok := tx.Statement.Dest.(*models.User); ok && user.Email == "late@example.com" {
+			tx.AddError(gorm.ErrDuplicatedKey)
+		}
+	}))
+
+	results := service.CreateUsers(context.Background(), []models.User{
+		batchUser("111.444.777-35", "first@example.com"),
+		batchUser("123.456.789-09", "late@example.com"),
+	}, false)
+
+	assert.Equal(t, []int{http.StatusCreated, http.StatusConflict}, batchStatuses(results))
+	assert.Equal(t, "CPF already registered", results[1].Error)
+}
+
+func TestUserAuditLogHoldsNoPersonalData(t *testing.T) {
+	service := newBatchTestService(t)
+	user := batchUser("529.982.247-25", "john@example.com")
+	require.NoError(t, service.CreateUser(context.Background(), &user))
+
+	var entry audit.Log
+	require.NoError(t, service.DB.First(&entry, "entity = ?", "user").Error)
+	assert.Equal(t, fmt.Sprint(user.ID), entry.EntityID)
+	assert.Equal(t, audit.Change{Redacted: true}, entry.Changes["email"])
+	for field, change := range entry.Changes {
+		assert.Equal(t, audit.Change{Redacted: true}, change, field)
+	}
+	assert.NotContains(t, entry.Changes, "cpf_hash")
+}
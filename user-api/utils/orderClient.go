@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"shared/config"
+	"shared/logging"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// httpClient traces outgoing requests and propagates the W3C traceparent header
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// OrderAPIURL returns the base URL of the order-api
+func OrderAPIURL() string {
+	return config.GetEnv("ORDER_API_URL", "http://order-service:8080")
+}
+
+// newOrderAPIRequest builds a request to the order-api, authenticated with ORDER_API_KEY when set
+// and carrying the request ID of ctx as X-Request-ID
+func newOrderAPIRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if apiKey := config.GetEnv("ORDER_API_KEY", ""); apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	return req, nil
+}
+
+// GetUserOrders fetches every order of a user from the order-api
+func GetUserOrders(ctx context.Context, userID uint) ([]json.RawMessage, error) {
+	url := fmt.Sprintf("%s/users/%d/orders", OrderAPIURL(), userID)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := newOrderAPIRequest(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var orders []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// PseudonymizeUserOrders asks the order-api to detach the orders of a user from its identity
+func PseudonymizeUserOrders(ctx context.Context, userID uint) (int64, error) {
+	url := fmt.Sprintf("%s/users/%d/orders/pseudonymize", OrderAPIURL(), userID)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := newOrderAPIRequest(ctx, http.MethodPost, url)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		OrdersPseudonymized int64 `json:"orders_pseudonymized"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.OrdersPseudonymized, nil
+}
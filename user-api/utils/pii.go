@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix marks values encrypted at rest; values without it are legacy plain text
+const encryptedPrefix = "enc:v1:"
+
+var (
+	piiCipher     cipher.AEAD
+	blindIndexKey []byte
+)
+
+func init() {
+	schema.RegisterSerializer("pii", PIISerializer{})
+}
+
+// InitPII configures the AES-256-GCM key used to encrypt PII at rest and the HMAC key used for blind indexes
+func InitPII(encryptionKey, indexKey string) error {
+	key, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil {
+		return fmt.Errorf("invalid PII encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return errors.New("PII encryption key must be 32 bytes")
+	}
+	if indexKey == "" {
+		return errors.New("PII blind index key is required")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	piiCipher = gcm
+	blindIndexKey = []byte(indexKey)
+	return nil
+}
+
+// EncryptPII encrypts a value with a random nonce
+func EncryptPII(plain string) (string, error) {
+	if piiCipher == nil {
+		return "", errors.New("PII encryption is not configured")
+	}
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, piiCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := piiCipher.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptPII decrypts a value produced by EncryptPII; legacy plain text values are returned as is
+func DecryptPII(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if piiCipher == nil {
+		return "", errors.New("PII encryption is not configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	nonceSize := piiCipher.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("invalid encrypted value")
+	}
+	plain, err := piiCipher.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// BlindIndex returns a deterministic keyed hash that allows equality lookups on encrypted values
+func BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, blindIndexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// OnlyDigits removes every non-digit character
+func OnlyDigits(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// NormalizePhone reduces a phone number to its digits without the Brazilian country code,
+// so "+55 (11) 91234-5678" and "11912345678" are the same number
+func NormalizePhone(phone string) string {
+	digits := OnlyDigits(phone)
+	if len(digits) >= 12 && strings.HasPrefix(digits, "55") {
+		return digits[2:]
+	}
+	return digits
+}
+
+// PIISerializer encrypts string fields tagged with `gorm:"serializer:pii"`
+type PIISerializer struct{}
+
+func (PIISerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch value := dbValue.(type) {
+	case nil:
+		return nil
+	case string:
+		stored = value
+	case []byte:
+		stored = string(value)
+	default:
+		return fmt.Errorf("unsupported PII value type %T", dbValue)
+	}
+
+	plain, err := DecryptPII(stored)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plain)
+	return nil
+}
+
+func (PIISerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plain, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported PII field type %T", fieldValue)
+	}
+	return EncryptPII(plain)
+}
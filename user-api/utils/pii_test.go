@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initTestPII(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, InitPII(key, "index-key"))
+}
+
+func TestEncryptPIIRoundTrip(t *testing.T) {
+	initTestPII(t)
+
+	first, err := EncryptPII("12345678909")
+	require.NoError(t, err)
+	second, err := EncryptPII("12345678909")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, encryptedPrefix))
+	assert.NotContains(t, first, "12345678909")
+	assert.NotEqual(t, first, second, "every encryption uses a fresh nonce")
+
+	plain, err := DecryptPII(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678909", plain)
+
+	empty, err := EncryptPII("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+}
+
+func TestDecryptPIIRejectsTamperedValues(t *testing.T) {
+	initTestPII(t)
+
+	encrypted, err := EncryptPII("11912345678")
+	require.NoError(t, err)
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	require.NoError(t, err)
+	sealed[len(sealed)-1] ^= 0x01
+
+	_, err = DecryptPII(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed))
+	assert.Error(t, err)
+
+	_, err = DecryptPII(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed[:4]))
+	assert.EqualError(t, err, "invalid encrypted value")
+
+	_, err = DecryptPII(encryptedPrefix + "not base64!")
+	assert.Error(t, err)
+}
+
+func TestDecryptPIIReturnsLegacyPlainText(t *testing.T) {
+	initTestPII(t)
+
+	plain, err := DecryptPII("12345678909")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678909", plain)
+}
+
+func TestInitPIIValidatesKeys(t *testing.T) {
+	assert.Error(t, InitPII("not base64!", "index-key"))
+	assert.EqualError(t, InitPII(base64.StdEncoding.EncodeToString([]byte("short")), "index-key"), "PII encryption key must be 32 bytes")
+	assert.EqualError(t, InitPII(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))), ""), "PII blind index key is required")
+}
+
+func TestBlindIndex(t *testing.T) {
+	initTestPII(t)
+
+	assert.Equal(t, BlindIndex("12345678909"), BlindIndex("12345678909"))
+	assert.NotEqual(t, BlindIndex("12345678909"), BlindIndex("12345678900"))
+	assert.Len(t, BlindIndex("12345678909"), 64)
+}
+
+func TestNormalizePhone(t *testing.T) {
+	assert.Equal(t, "11912345678", NormalizePhone("+55 (11) 91234-5678"))
+	assert.Equal(t, "11912345678", NormalizePhone("11912345678"))
+	assert.Equal(t, "1134567890", NormalizePhone("55 11 3456-7890"))
+	assert.Equal(t, "5512345678", NormalizePhone("(55) 1234-5678"), "a DDD of 55 without the country code is kept")
+	assert.Equal(t, "", NormalizePhone("---"))
+}